@@ -0,0 +1,181 @@
+// Package client is a Go client for the deimos backend HTTP API. It only depends on the
+// JSON contract, so importing it does not pull in the scraper and its browser.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout bounds each call unless WithTimeout says otherwise. Scrapes can take
+// a while, so it is generous.
+const DefaultTimeout = 60 * time.Second
+
+// Client calls the backend's JSON endpoints
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	timeout    time.Duration
+	apiKey     string
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sets the http.Client used for requests
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithTimeout sets how long each call may take, 0 to rely on the caller's context alone
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// WithAPIKey sends key in the X-API-Key header of every request
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.apiKey = key
+	}
+}
+
+// NewClient creates a client for the backend at baseURL, such as http://localhost:8080
+func NewClient(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: http.DefaultClient,
+		timeout:    DefaultTimeout,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// APIError is returned when the backend answers with an error status
+type APIError struct {
+	StatusCode int
+	Code       string // stable machine-readable code such as VIDEO_NOT_FOUND
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("deimos backend returned %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Search returns a page of search results for query
+func (c *Client) Search(ctx context.Context, query string, page int) (*SearchResult, error) {
+	params := url.Values{}
+	params.Set("page", strconv.Itoa(page))
+
+	var result SearchResult
+	if err := c.getJSON(ctx, "/search/"+url.PathEscape(query)+"?"+params.Encode(), &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetVideoURL returns the direct video URL of a TikTok video page
+func (c *Client) GetVideoURL(ctx context.Context, videoPageUrl string) (string, error) {
+	var body struct {
+		VideoURL string `json:"videoUrl"`
+	}
+	if err := c.getJSON(ctx, "/get-video-url?url="+url.QueryEscape(videoPageUrl), &body); err != nil {
+		return "", err
+	}
+	return body.VideoURL, nil
+}
+
+// ProxyVideo streams a video through the backend's proxy. The caller must close the
+// returned body, and the client timeout covers the whole download.
+func (c *Client) ProxyVideo(ctx context.Context, videoUrl string) (io.ReadCloser, error) {
+	ctx, cancel := c.withTimeout(ctx)
+
+	resp, err := c.do(ctx, "/proxy-video?url="+url.QueryEscape(videoUrl))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}, nil
+}
+
+// getJSON fetches path and decodes the JSON response into out
+func (c *Client) getJSON(ctx context.Context, path string, out any) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	resp, err := c.do(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding response from %s: %w", path, err)
+	}
+	return nil
+}
+
+// do sends a GET request for path and turns error statuses into an *APIError
+func (c *Client) do(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+
+		// The backend reports failures as {"error": {"code": "...", "message": "..."}}
+		var body struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&body) != nil || body.Error.Message == "" {
+			body.Error.Message = http.StatusText(resp.StatusCode)
+		}
+		return nil, &APIError{StatusCode: resp.StatusCode, Code: body.Error.Code, Message: body.Error.Message}
+	}
+	return resp, nil
+}
+
+// withTimeout applies the client timeout to ctx
+func (c *Client) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.timeout)
+}
+
+// cancelOnClose releases the request context once the body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
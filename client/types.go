@@ -0,0 +1,38 @@
+package client
+
+// Video is a TikTok video as returned by the backend
+type Video struct {
+	URL          string   `json:"url"`
+	VideoID      string   `json:"videoId"`
+	AuthorHandle string   `json:"authorHandle"`
+	AuthorName   string   `json:"authorName"`
+	AuthorAvatar string   `json:"authorAvatar"`
+	Thumbnail    string   `json:"thumbnail"`
+	HasThumbnail bool     `json:"hasThumbnail"`
+	Caption      string   `json:"caption"`
+	User         string   `json:"user"`
+	Views        int      `json:"views"`
+	Likes        int      `json:"likes"`
+	Comments     int      `json:"comments"`
+	Hashtags     []string `json:"hashtags"`
+	Sound        *Sound   `json:"sound,omitempty"`
+}
+
+// Sound is the music or original audio a video uses
+type Sound struct {
+	Title  string `json:"title"`
+	Author string `json:"author"`
+	URL    string `json:"url"`
+}
+
+// SearchResult is one page of videos along with pagination metadata
+type SearchResult struct {
+	Videos       []Video  `json:"videos"`
+	Page         int      `json:"page"`
+	Offset       int      `json:"offset"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	HasNextPage  bool     `json:"hasNextPage"`
+	TotalFetched int      `json:"totalFetched"`
+	Empty        bool     `json:"empty"`
+	Warnings     []string `json:"warnings,omitempty"`
+}
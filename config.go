@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// getEnv returns the value of an environment variable or fallback when unset
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+// getEnvInt returns an integer environment variable or fallback when unset or invalid
+func getEnvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(getEnv(key, ""))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// getEnvFloat returns a float environment variable or fallback when unset or invalid
+func getEnvFloat(key string, fallback float64) float64 {
+	value, err := strconv.ParseFloat(getEnv(key, ""), 64)
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// getEnvDuration returns a duration environment variable such as "60s" or fallback when unset or invalid
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(getEnv(key, ""))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// chromeFlag is one Chrome command-line switch, true for bare switches and false to drop one
+type chromeFlag struct {
+	name  string
+	value any
+}
+
+// chromeFlagName matches a switch name with an optional leading "--"
+var chromeFlagName = regexp.MustCompile(`^(--)?[a-z][a-z0-9-]*$`)
+
+// parseChromeFlags parses flags such as "window-size=1280,720 --disable-extensions".
+// Flags are separated by spaces or commas, and a comma-separated part that does not
+// start with a switch name continues the previous value, so "window-size=1280,720"
+// stays one flag. "name=false" removes a default switch.
+func parseChromeFlags(raw string) ([]chromeFlag, error) {
+	var parts []string
+	for _, field := range strings.Fields(raw) {
+		for _, part := range strings.Split(field, ",") {
+			name, _, _ := strings.Cut(part, "=")
+			if len(parts) > 0 && strings.Contains(parts[len(parts)-1], "=") && !chromeFlagName.MatchString(name) {
+				parts[len(parts)-1] += "," + part
+				continue
+			}
+			if part != "" {
+				parts = append(parts, part)
+			}
+		}
+	}
+
+	flags := make([]chromeFlag, 0, len(parts))
+	for _, part := range parts {
+		name, value, hasValue := strings.Cut(part, "=")
+		if !chromeFlagName.MatchString(name) {
+			return nil, fmt.Errorf("invalid Chrome flag %q", part)
+		}
+		name = strings.TrimPrefix(name, "--")
+
+		switch {
+		case !hasValue || value == "true":
+			flags = append(flags, chromeFlag{name: name, value: true})
+		case value == "false":
+			flags = append(flags, chromeFlag{name: name, value: false})
+		case value == "":
+			return nil, fmt.Errorf("invalid Chrome flag %q: empty value", part)
+		default:
+			flags = append(flags, chromeFlag{name: name, value: value})
+		}
+	}
+	return flags, nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"deimosbackend/services"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Error codes for failures that do not come from a service error
+const (
+	codeInternal         = "INTERNAL"
+	codeMissingParameter = "MISSING_PARAMETER"
+	codeInvalidParameter = "INVALID_PARAMETER"
+	codeInvalidBody      = "INVALID_BODY"
+	codeRateLimited      = "RATE_LIMITED"
+	codeTimeout          = "TIMEOUT"
+	codeUnauthorized     = "UNAUTHORIZED"
+	codeQueueFull        = "QUEUE_FULL"
+)
+
+// errorMappings ties each service error to its HTTP status and stable error code.
+// The first match wins, so more specific errors come first.
+var errorMappings = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{services.ErrEmptyQuery, http.StatusBadRequest, "EMPTY_QUERY"},
+	{services.ErrInvalidURL, http.StatusBadRequest, "INVALID_URL"},
+	{services.ErrInvalidParameter, http.StatusBadRequest, codeInvalidParameter},
+	{services.ErrProfilePrivate, http.StatusForbidden, "PROFILE_PRIVATE"},
+	{services.ErrForbiddenTarget, http.StatusForbidden, "FORBIDDEN_TARGET"},
+	{services.ErrVideoNotFound, http.StatusNotFound, "VIDEO_NOT_FOUND"},
+	{services.ErrProfileNotFound, http.StatusNotFound, "PROFILE_NOT_FOUND"},
+	{services.ErrNoMoreResults, http.StatusNotFound, "NO_MORE_RESULTS"},
+	{services.ErrBlocked, http.StatusTooManyRequests, "BLOCKED"},
+	{services.ErrCaptchaRequired, http.StatusServiceUnavailable, "CAPTCHA_REQUIRED"},
+	{services.ErrTabClosed, http.StatusServiceUnavailable, "BROWSER_UNAVAILABLE"},
+	{services.ErrUnexpectedContent, http.StatusBadGateway, "UNEXPECTED_CONTENT"},
+	{services.ErrResponseTooLarge, http.StatusBadGateway, "RESPONSE_TOO_LARGE"},
+	{services.ErrSelectorNotFound, http.StatusBadGateway, "SELECTOR_NOT_FOUND"},
+	{services.ErrNavTimeout, http.StatusGatewayTimeout, "NAV_TIMEOUT"},
+	{services.ErrScrapeTimeout, http.StatusGatewayTimeout, "SCRAPE_TIMEOUT"},
+	{context.DeadlineExceeded, http.StatusGatewayTimeout, codeTimeout},
+}
+
+// statusForError maps service errors to the HTTP status returned to clients
+func statusForError(err error) int {
+	for _, mapping := range errorMappings {
+		if errors.Is(err, mapping.err) {
+			return mapping.status
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+// errorCode maps service errors to the machine-readable code returned to clients
+func errorCode(err error) string {
+	for _, mapping := range errorMappings {
+		if errors.Is(err, mapping.err) {
+			return mapping.code
+		}
+	}
+	return codeInternal
+}
+
+// apiError is the body of every error response, nested under "error"
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Field   string `json:"field,omitempty"`
+}
+
+// newAPIError describes err with its stable code
+func newAPIError(err error) apiError {
+	return apiError{Code: errorCode(err), Message: err.Error()}
+}
+
+// respondError writes err as {"error": {"code": ..., "message": ...}} with its mapped status
+func respondError(c *gin.Context, err error) {
+	writeError(c, statusForError(err), newAPIError(err))
+}
+
+// writeError aborts the request with body as the error response
+func writeError(c *gin.Context, status int, body apiError) {
+	c.AbortWithStatusJSON(status, gin.H{"error": body})
+}
+
+// respondMissingParameter reports a required query parameter that was not given
+func respondMissingParameter(c *gin.Context, field string) {
+	writeError(c, http.StatusBadRequest, apiError{
+		Code:    codeMissingParameter,
+		Message: field + " parameter is required",
+		Field:   field,
+	})
+}
+
+// batchErrors converts a batch error into a JSON-friendly map of item to error
+func batchErrors(err error) map[string]apiError {
+	items := make(map[string]apiError)
+
+	var batchErr *services.BatchError
+	if errors.As(err, &batchErr) {
+		for item, itemErr := range batchErr.Errors {
+			items[item] = newAPIError(itemErr)
+		}
+	}
+	return items
+}
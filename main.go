@@ -1,75 +1,804 @@
 package main
 
 import (
+	"context"
 	"deimosbackend/services"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
-	"github.com/gin-contrib/cors"
+	"github.com/chromedp/chromedp"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+// startTime is when the process started, used for the uptime in /stats
+var startTime = time.Now()
+
+// Maximum number of Chrome tabs open at the same time
+const browserPoolSize = 4
+
+// Maximum number of items accepted by the batch endpoints
+const maxBatchSize = 20
+
+// How long clients and edge caches may reuse a search response, set from SEARCH_MAX_AGE
+var searchMaxAge = time.Minute
+
+// How long in-flight requests may take to drain on shutdown
+const shutdownTimeout = 30 * time.Second
+
+// Chrome options read from the environment in init, used to start the allocators in main
+var chromeOptions []chromedp.ExecAllocatorOption
+
+// Supervised allocators the scrapes' tabs are spread over, each recreated if its Chrome dies
+var allocators []*services.Allocator
+
+// Pool of tabs on allocators used by the scraping functions
+var browserPool *services.BrowserPool
+
+func init() {
+	// Browser identity shared by Chrome and the video proxy
+	services.UserAgent = getEnv("USER_AGENT", services.UserAgent)
+	services.AcceptLanguage = getEnv("ACCEPT_LANGUAGE", services.AcceptLanguage)
+
+	searchMaxAge = getEnvDuration("SEARCH_MAX_AGE", searchMaxAge)
+	services.TrendingHashtagsTTL = getEnvDuration("TRENDING_HASHTAGS_TTL", services.TrendingHashtagsTTL)
+
+	// Budget of a whole scrape and of its page load within it
+	services.ScrapeTimeout = getEnvDuration("SCRAPE_TIMEOUT", services.ScrapeTimeout)
+	services.NavTimeout = getEnvDuration("NAV_TIMEOUT", services.NavTimeout)
+
+	// Residual wait after pages render, lower it to cut latency on fast connections
+	services.SettleDelay = getEnvDuration("SETTLE_DELAY", services.SettleDelay)
+	services.SelectorWaitTimeout = getEnvDuration("SELECTOR_WAIT_TIMEOUT", services.SelectorWaitTimeout)
+
+	// Resources tabs skip while scraping, "none" to load everything
+	if raw := getEnv("BLOCK_RESOURCE_TYPES", ""); raw == "none" {
+		services.BlockedResourceTypes = nil
+	} else if raw != "" {
+		types, err := services.ParseResourceTypes(raw)
+		if err != nil {
+			log.Fatalf("BLOCK_RESOURCE_TYPES: %v", err)
+		}
+		services.BlockedResourceTypes = types
+	}
+	if raw := getEnv("BLOCK_DOMAINS", ""); raw == "none" {
+		services.BlockedDomains = nil
+	} else if raw != "" {
+		services.BlockedDomains = nil
+		for _, domain := range strings.Split(raw, ",") {
+			if domain = strings.TrimSpace(domain); domain != "" {
+				services.BlockedDomains = append(services.BlockedDomains, domain)
+			}
+		}
+	}
+
+	// Order in which feeds try their extraction strategies
+	if raw := getEnv("EXTRACTION_STRATEGIES", ""); raw != "" {
+		strategies, err := services.ParseStrategies(raw)
+		if err != nil {
+			log.Fatalf("EXTRACTION_STRATEGIES: %v", err)
+		}
+		services.ExtractionStrategies = strategies
+	}
+
+	// List the cards that failed to parse in results while debugging
+	services.ReportWarnings = getEnv("DEBUG", "") == "true"
+
+	// Try the raw HTML over plain HTTP before starting the browser
+	services.StaticFetch = getEnv("STATIC_FETCH", "") == "true"
+
+	// Randomize viewports and delays, repeatably when HUMANIZE_SEED is set
+	services.Humanize = getEnv("HUMANIZE", "") == "true"
+	if seed := getEnv("HUMANIZE_SEED", ""); seed != "" {
+		value, err := strconv.ParseUint(seed, 10, 64)
+		if err != nil {
+			log.Fatalf("HUMANIZE_SEED: %v", err)
+		}
+		services.SeedHumanize(value)
+	}
+
+	// Configure the headless Chrome instance used for scraping, with CHROME_FLAGS
+	// added to or overriding the defaults
+	chromeFlags := []chromeFlag{
+		{name: "headless", value: true},
+		{name: "disable-gpu", value: true},
+		{name: "no-sandbox", value: true},
+		{name: "disable-dev-shm-usage", value: true},
+	}
+	extraFlags, err := parseChromeFlags(getEnv("CHROME_FLAGS", ""))
+	if err != nil {
+		log.Fatalf("CHROME_FLAGS: %v", err)
+	}
+	chromeFlags = append(chromeFlags, extraFlags...)
+
+	// Later flags win, so log each name once with its final value
+	opts := append(chromedp.DefaultExecAllocatorOptions[:], chromedp.UserAgent(services.UserAgent))
+	var names []string
+	values := make(map[string]any)
+	for _, flag := range chromeFlags {
+		opts = append(opts, chromedp.Flag(flag.name, flag.value))
+		if _, ok := values[flag.name]; !ok {
+			names = append(names, flag.name)
+		}
+		values[flag.name] = flag.value
+	}
+	effective := make([]string, 0, len(names))
+	for _, name := range names {
+		effective = append(effective, fmt.Sprintf("%s=%v", name, values[name]))
+	}
+	log.Printf("Chrome flags: %s", strings.Join(effective, " "))
+
+	if services.Humanize {
+		opts = append(opts, chromedp.WindowSize(services.RandomWindowSize()))
+	}
+
+	// Use a specific Chrome binary instead of searching the usual install locations
+	if chromePath := getEnv("CHROME_PATH", ""); chromePath != "" {
+		opts = append(opts, chromedp.ExecPath(chromePath))
+	}
+
+	// Route both the browser and the video proxy through SCRAPE_PROXY when set
+	if rawProxy := getEnv("SCRAPE_PROXY", ""); rawProxy != "" {
+		proxyURL, err := services.ParseProxyURL(rawProxy)
+		if err != nil {
+			log.Fatalf("SCRAPE_PROXY: %v", err)
+		}
+		opts = append(opts, chromedp.ProxyServer(proxyURL.String()))
+		services.UseUpstreamProxy(proxyURL)
+	}
+
+	chromeOptions = opts
+
+	// Patch TikTok markup changes from SELECTORS_FILE and SELECTOR_* without a rebuild
+	selectors := services.DefaultSelectors
+	if path := getEnv("SELECTORS_FILE", ""); path != "" {
+		loaded, err := services.LoadSelectors(path, selectors)
+		if err != nil {
+			log.Fatalf("SELECTORS_FILE: %v", err)
+		}
+		selectors = loaded
+	}
+	selectors.ApplyEnv(os.LookupEnv)
+	if err := selectors.Validate(); err != nil {
+		log.Fatalf("Invalid selectors: %v", err)
+	}
+	services.UseSelectors(selectors)
+
+	// Restrict the video proxy to the CDN domains in PROXY_ALLOWED_HOSTS
+	if allowedHosts := getEnv("PROXY_ALLOWED_HOSTS", ""); allowedHosts != "" {
+		services.AllowedProxyHosts = strings.Split(allowedHosts, ",")
+	}
+
+	// Per-CDN Referer and Origin for hosts that refuse TikTok's
+	if rawHeaders := getEnv("PROXY_CDN_HEADERS", ""); rawHeaders != "" {
+		overrides, err := services.ParseCDNHeaders(rawHeaders)
+		if err != nil {
+			log.Fatalf("PROXY_CDN_HEADERS: %v", err)
+		}
+		services.CDNHeaderOverrides = overrides
+	}
+
+	// Cut off proxied responses past PROXY_MAX_MB, whatever the upstream claims
+	services.MaxProxyBytes = int64(getEnvInt("PROXY_MAX_MB", 200)) << 20
+
+	// Keep proxied videos on disk when VIDEO_CACHE_DIR is set
+	if cacheDir := getEnv("VIDEO_CACHE_DIR", ""); cacheDir != "" {
+		maxBytes := int64(getEnvInt("VIDEO_CACHE_MAX_MB", 1024)) << 20
+		cache, err := services.NewVideoCache(cacheDir, maxBytes)
+		if err != nil {
+			log.Fatalf("VIDEO_CACHE_DIR: %v", err)
+		}
+		services.UseVideoCache(cache)
+	}
+
+	// Keep proxied thumbnails in memory, THUMBNAIL_CACHE_MB=0 turns the cache off
+	if maxMB := getEnvInt("THUMBNAIL_CACHE_MB", 32); maxMB > 0 {
+		ttl := getEnvDuration("THUMBNAIL_CACHE_TTL", time.Hour)
+		services.UseThumbnailCache(services.NewThumbnailCache(int64(maxMB)<<20, ttl))
+	}
+}
+
 func main() {
+	version := currentVersion()
+	log.Printf("Starting deimos-backend commit=%s built=%s go=%s", version.GitCommit, version.BuildTime, version.GoVersion)
+
+	// One Chrome process per allocator, no more than there are tabs to spread over them
+	for range min(max(getEnvInt("CHROME_ALLOCATORS", 1), 1), browserPoolSize) {
+		allocators = append(allocators, services.NewAllocator(context.Background(), chromeOptions...))
+	}
+
+	// Reuse a bounded set of tabs across requests
+	browserPool = services.NewBrowserPool(allocators, browserPoolSize)
+	services.UseBrowserPool(browserPool)
+
+	// Fail fast with a clear message when Chrome is missing, rather than on the first scrape
+	for _, allocator := range allocators {
+		if err := services.VerifyBrowserLaunch(allocator); err != nil {
+			closeAllocators()
+			log.Fatalf("Browser startup check failed: %v", err)
+		}
+	}
+
+	// Open tabs ahead of the first requests, without holding up startup for long
+	browserPool.WarmUp(getEnvInt("WARMUP_TABS", 1), getEnvDuration("WARMUP_TIMEOUT", 20*time.Second))
+
+	// Recycle tabs idle for over TAB_IDLE_TIMEOUT to bound Chrome's memory, 0 to keep them
+	reaperCtx, stopReaper := context.WithCancel(context.Background())
+	go browserPool.ReapIdleTabs(reaperCtx, getEnvDuration("TAB_IDLE_TIMEOUT", 10*time.Minute))
+
 	// Initialize a Gin router
 	router := gin.Default()
 
-	// Use the CORS middleware with default settings
-	router.Use(cors.Default())
+	// Count requests for /stats
+	router.Use(countRequests())
+
+	// Use the CORS middleware, restricted to ALLOWED_ORIGINS when set
+	router.Use(corsMiddleware(getEnv("ALLOWED_ORIGINS", "")))
+
+	// Require an API key on everything but /health when API_KEYS is set
+	router.Use(apiKeyAuth(getEnv("API_KEYS", "")))
+
+	// Compress JSON responses, leaving media and event streams alone
+	router.Use(compression())
+
+	// Break down where scraping time went in an X-Timing header when DEBUG=true
+	if getEnv("DEBUG", "") == "true" {
+		router.Use(timingHeaders())
+	}
+
+	// No single request may run longer than REQUEST_TIMEOUT
+	router.Use(requestTimeout(getEnvDuration("REQUEST_TIMEOUT", 60*time.Second)))
+
+	// Per-IP rate limit for the routes that drive the browser or proxy video
+	limiter := rateLimit(newIPRateLimiter(
+		getEnvFloat("RATE_LIMIT_RPS", 1),
+		getEnvInt("RATE_LIMIT_BURST", 5),
+	))
+
+	// Global cap on concurrent scrapes, batches count for as many slots as they run at once.
+	// Requests over the cap queue up to SCRAPE_QUEUE_DEPTH deep.
+	slots := newScrapeSlots(int64(getEnvInt("MAX_CONCURRENT_SCRAPES", 8)), int64(getEnvInt("SCRAPE_QUEUE_DEPTH", 32)))
+	scrape := slots.take(1)
+	batchScrape := slots.take(int64(services.BatchConcurrency))
+
+	// Liveness/readiness probe that checks every embedded browser responds
+	router.GET("/health", func(c *gin.Context) {
+		for _, allocator := range allocators {
+			if err := services.CheckBrowser(allocator); err != nil {
+				c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "breaker": services.BreakerState()})
+				return
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok", "breaker": services.BreakerState()})
+	})
+
+	// Build information for ops and support
+	router.GET("/version", func(c *gin.Context) {
+		c.JSON(http.StatusOK, currentVersion())
+	})
+
+	// Prometheus metrics for scrapes, proxying and browser tabs
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
+	// Human-friendly JSON snapshot of the scraper internals
+	router.GET("/stats", func(c *gin.Context) {
+		uptime := time.Since(startTime)
+		c.JSON(http.StatusOK, gin.H{
+			"uptime":         uptime.Round(time.Second).String(),
+			"uptimeSeconds":  int64(uptime.Seconds()),
+			"requestsServed": requestsServed.Load(),
+			"scraper":        services.GetStats(),
+			"queue":          slots.stats(),
+		})
+	})
 
 	// Define the search route with pagination
-	router.GET("/search/:query", func(c *gin.Context) {
+	router.GET("/search/:query", limiter, scrape, func(c *gin.Context) {
 		query := c.Param("query")
 
-		// Get the page number from query parameters, defaulting to 1 if not provided
-		pageParam := c.DefaultQuery("page", "1")
-		page, err := strconv.Atoi(pageParam)
-		if err != nil || page < 1 {
-			page = 1 // Ensure page is at least 1
+		// Default to the first page, but reject parameters that were given and are invalid
+		params, err := parseSearchParams(c)
+		if err != nil {
+			respondParamError(c, err)
+			return
+		}
+
+		// Call SearchTikTokVideos with the query, page and filters
+		result, err := services.SearchTikTokVideos(c.Request.Context(), query, params.Page, params.Options())
+		if err != nil {
+			c.Header("Cache-Control", "no-store")
+			respondError(c, err)
+			return
+		}
+
+		result = params.sortResult(result)
+
+		// Let browsers and edge caches reuse identical searches for a short while
+		c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(searchMaxAge.Seconds())))
+		c.Header("Vary", "Accept-Encoding, Origin")
+		if result.FromCache {
+			c.Header("X-Cache", "HIT")
+		} else {
+			c.Header("X-Cache", "MISS")
+		}
+		setResultEmpty(c, result)
+
+		// Trim the videos to the requested fields, keeping the pagination metadata
+		if videos := selectVideoFields(result.Videos, c.Query("fields")); videos != nil {
+			respondJSON(c, http.StatusOK, gin.H{
+				"videos":       videos,
+				"page":         result.Page,
+				"offset":       result.Offset,
+				"itemsPerPage": result.ItemsPerPage,
+				"hasNextPage":  result.HasNextPage,
+				"totalFetched": result.TotalFetched,
+				"empty":        result.Empty,
+			})
+			return
+		}
+		respondJSON(c, http.StatusOK, result)
+	})
+
+	// Stream search results as server-sent events while the page is being scraped
+	router.GET("/search/stream/:query", limiter, scrape, func(c *gin.Context) {
+		query := c.Param("query")
+
+		params, err := parseSearchParams(c)
+		if err != nil {
+			respondParamError(c, err)
+			return
+		}
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("X-Accel-Buffering", "no") // Keep reverse proxies from buffering events
+
+		// Send each video as soon as the scraper extracts it
+		emit := func(video services.Video) {
+			c.SSEvent("video", video)
+			c.Writer.Flush()
+		}
+
+		result, err := services.StreamSearchTikTokVideos(c.Request.Context(), query, params.Page, params.Options(), emit)
+		if err != nil {
+			c.SSEvent("error", gin.H{"error": newAPIError(err), "status": statusForError(err)})
+		} else {
+			c.SSEvent("done", gin.H{
+				"page":         result.Page,
+				"itemsPerPage": result.ItemsPerPage,
+				"hasNextPage":  result.HasNextPage,
+				"totalFetched": result.TotalFetched,
+				"empty":        result.Empty,
+			})
+		}
+		c.Writer.Flush()
+	})
+
+	// Run several searches in one round trip
+	router.POST("/search", limiter, batchScrape, func(c *gin.Context) {
+		var body struct {
+			Queries   []string `json:"queries"`
+			Page      int      `json:"page"`
+			SortBy    string   `json:"sortBy"`
+			DateRange string   `json:"dateRange"`
+			Lang      string   `json:"lang"`
+			Region    string   `json:"region"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil || len(body.Queries) == 0 {
+			writeError(c, http.StatusBadRequest, apiError{Code: codeInvalidBody, Message: "body must contain a non-empty queries array"})
+			return
+		}
+		if len(body.Queries) > maxBatchSize {
+			writeError(c, http.StatusBadRequest, apiError{Code: codeInvalidBody, Message: fmt.Sprintf("at most %d queries per request", maxBatchSize)})
+			return
+		}
+		if body.Page < 1 {
+			body.Page = 1
+		}
+
+		// Validate the shared filters once instead of failing every query
+		opts := services.SearchOptions{SortBy: body.SortBy, DateRange: body.DateRange, Lang: body.Lang, Region: body.Region}
+		if err := opts.Validate(); err != nil {
+			respondError(c, err)
+			return
 		}
 
-		// Call SearchTikTokVideos with the query and page
-		videos, err := services.SearchTikTokVideos(query, page)
+		results, err := services.SearchMany(c.Request.Context(), body.Queries, body.Page, opts)
+		c.JSON(http.StatusOK, gin.H{"results": results, "errors": batchErrors(err)})
+	})
+
+	// Browse videos by hashtag with pagination
+	router.GET("/hashtag/:tag", limiter, scrape, func(c *gin.Context) {
+		tag := c.Param("tag")
+
+		params, err := parseFeedParams(c)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondParamError(c, err)
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"videos": videos})
+
+		result, err := services.SearchByHashtag(c.Request.Context(), tag, params.Page, params.PageOptions())
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		setResultEmpty(c, result)
+		c.JSON(http.StatusOK, params.sortResult(result))
+	})
+
+	// Trending videos from the explore feed with pagination
+	router.GET("/trending", limiter, scrape, func(c *gin.Context) {
+		params, err := parseFeedParams(c)
+		if err != nil {
+			respondParamError(c, err)
+			return
+		}
+
+		result, err := services.GetTrendingVideos(c.Request.Context(), params.Page, params.PageOptions())
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		setResultEmpty(c, result)
+		c.JSON(http.StatusOK, params.sortResult(result))
+	})
+
+	// Trending hashtags from the discover page, cached for TRENDING_HASHTAGS_TTL
+	router.GET("/trending/hashtags", limiter, scrape, func(c *gin.Context) {
+		hashtags, err := services.GetTrendingHashtags(c.Request.Context())
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"hashtags": hashtags})
+	})
+
+	// List a creator's videos with pagination
+	router.GET("/user/:username", limiter, scrape, func(c *gin.Context) {
+		username := c.Param("username")
+
+		params, err := parseFeedParams(c)
+		if err != nil {
+			respondParamError(c, err)
+			return
+		}
+
+		result, err := services.GetUserVideos(c.Request.Context(), username, params.Page, params.PageOptions())
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		setResultEmpty(c, result)
+		c.JSON(http.StatusOK, params.sortResult(result))
+	})
+
+	// Videos TikTok recommends next to a video, with pagination
+	router.GET("/related", limiter, scrape, func(c *gin.Context) {
+		url := c.Query("url")
+		if url == "" {
+			respondMissingParameter(c, "url")
+			return
+		}
+
+		params, err := parseFeedParams(c)
+		if err != nil {
+			respondParamError(c, err)
+			return
+		}
+
+		result, err := services.GetRelatedVideos(c.Request.Context(), url, params.Page, params.PageOptions())
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		setResultEmpty(c, result)
+		c.JSON(http.StatusOK, params.sortResult(result))
 	})
 
 	// New endpoint to get the video URL
-	router.GET("/get-video-url", func(c *gin.Context) {
+	router.GET("/get-video-url", limiter, scrape, func(c *gin.Context) {
 		url := c.Query("url")
 		if url == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "url parameter is required"})
+			respondMissingParameter(c, "url")
+			return
+		}
+
+		// Preferred container, the response says which one was actually found
+		format := c.Query("format")
+		if !services.ValidVideoFormat(format) {
+			writeError(c, http.StatusBadRequest, apiError{
+				Code:    codeInvalidParameter,
+				Message: fmt.Sprintf("format must be mp4 or webm, got %q", format),
+				Field:   "format",
+			})
+			return
+		}
+
+		videoUrl, actualFormat, err := services.GetVideoUrl(c.Request.Context(), url, format)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"videoUrl": videoUrl, "format": actualFormat})
+	})
+
+	// Full details of one video page: caption, author, counts and sound
+	router.GET("/video", limiter, scrape, func(c *gin.Context) {
+		videoPageUrl := c.Query("url")
+		if videoPageUrl == "" {
+			respondMissingParameter(c, "url")
+			return
+		}
+
+		video, err := services.GetVideoDetails(c.Request.Context(), videoPageUrl)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, video)
+	})
+
+	// Lightweight embed metadata, served from TikTok's oEmbed API when possible
+	router.GET("/oembed", limiter, scrape, func(c *gin.Context) {
+		videoPageUrl := c.Query("url")
+		if videoPageUrl == "" {
+			respondMissingParameter(c, "url")
 			return
 		}
 
-		videoUrl, err := services.GetVideoUrl(url)
+		metadata, err := services.GetVideoMetadata(c.Request.Context(), videoPageUrl)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err)
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"videoUrl": videoUrl})
+		c.JSON(http.StatusOK, metadata)
 	})
 
+	// Top comments of a video
+	router.GET("/comments", limiter, scrape, func(c *gin.Context) {
+		videoPageUrl := c.Query("url")
+		if videoPageUrl == "" {
+			respondMissingParameter(c, "url")
+			return
+		}
+		limit, err := parseLimit(c, services.MaxCommentLimit)
+		if err != nil {
+			respondParamError(c, err)
+			return
+		}
+
+		comments, err := services.GetVideoComments(c.Request.Context(), videoPageUrl, limit)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"comments": comments})
+	})
+
+	// Expand a shared vt.tiktok.com link into the canonical video page URL
+	router.GET("/resolve", limiter, func(c *gin.Context) {
+		shortUrl := c.Query("url")
+		if shortUrl == "" {
+			respondMissingParameter(c, "url")
+			return
+		}
+
+		resolvedUrl, err := services.ResolveShortLink(c.Request.Context(), shortUrl)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"url": resolvedUrl})
+	})
+
+	// Video URL or slideshow images of a post
+	router.GET("/get-media", limiter, scrape, func(c *gin.Context) {
+		postUrl := c.Query("url")
+		if postUrl == "" {
+			respondMissingParameter(c, "url")
+			return
+		}
+
+		media, err := services.GetPostMedia(c.Request.Context(), postUrl)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, media)
+	})
+
+	// Resolve several video pages in one round trip
+	router.POST("/get-video-urls", limiter, batchScrape, func(c *gin.Context) {
+		var pageUrls []string
+		if err := c.ShouldBindJSON(&pageUrls); err != nil || len(pageUrls) == 0 {
+			writeError(c, http.StatusBadRequest, apiError{Code: codeInvalidBody, Message: "body must be a non-empty JSON array of URLs"})
+			return
+		}
+		if len(pageUrls) > maxBatchSize {
+			writeError(c, http.StatusBadRequest, apiError{Code: codeInvalidBody, Message: fmt.Sprintf("at most %d URLs per request", maxBatchSize)})
+			return
+		}
+
+		videoUrls, err := services.GetVideoUrls(c.Request.Context(), pageUrls)
+		c.JSON(http.StatusOK, gin.H{"videoUrls": videoUrls, "errors": batchErrors(err)})
+	})
+
+	// Refresh the details of several saved video pages in one round trip
+	router.POST("/videos/metadata", limiter, batchScrape, func(c *gin.Context) {
+		var pageUrls []string
+		if err := c.ShouldBindJSON(&pageUrls); err != nil || len(pageUrls) == 0 {
+			writeError(c, http.StatusBadRequest, apiError{Code: codeInvalidBody, Message: "body must be a non-empty JSON array of URLs"})
+			return
+		}
+		if len(pageUrls) > maxBatchSize {
+			writeError(c, http.StatusBadRequest, apiError{Code: codeInvalidBody, Message: fmt.Sprintf("at most %d URLs per request", maxBatchSize)})
+			return
+		}
+
+		videos, err := services.GetVideosMetadata(c.Request.Context(), pageUrls)
+		c.JSON(http.StatusOK, gin.H{"videos": videos, "errors": batchErrors(err)})
+	})
+
+	// Raw page HTML and card fields for diagnosing broken selectors, only registered when DEBUG=true
+	if getEnv("DEBUG", "") == "true" {
+		router.GET("/debug/html", limiter, scrape, func(c *gin.Context) {
+			pageUrl := c.Query("url")
+			if pageUrl == "" {
+				respondMissingParameter(c, "url")
+				return
+			}
+
+			html, err := services.FetchPageHTML(c.Request.Context(), pageUrl)
+			if err != nil {
+				respondError(c, err)
+				return
+			}
+			c.String(http.StatusOK, html)
+		})
+
+		// Values read from each card before normalization, to see which one broke
+		router.GET("/debug/fields", limiter, scrape, func(c *gin.Context) {
+			pageUrl := c.Query("url")
+			if pageUrl == "" {
+				respondMissingParameter(c, "url")
+				return
+			}
+
+			cards, err := services.FetchRawCards(c.Request.Context(), pageUrl)
+			if err != nil {
+				respondError(c, err)
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"cards": cards})
+		})
+	}
+
+	// GET and HEAD for the proxy endpoints, players probe the size with HEAD first
+	proxyMethods := []string{http.MethodGet, http.MethodHead}
+
 	// Proxy endpoint for the video content
-	router.GET("/proxy-video", func(c *gin.Context) {
+	router.Match(proxyMethods, "/proxy-video", limiter, func(c *gin.Context) {
 		videoUrl := c.Query("url")
 		if videoUrl == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "url parameter is required"})
+			respondMissingParameter(c, "url")
 			return
 		}
 
-		videoContent, err := services.ProxyVideoContent(videoUrl)
+		// Stream the video content to the client, honoring any Range header
+		if err := services.ProxyVideoContent(c.Writer, c.Request, videoUrl); err != nil {
+			// Only report the error if nothing has been streamed yet
+			if !c.Writer.Written() {
+				respondError(c, err)
+			}
+			return
+		}
+	})
+
+	// Check a video URL is still live and get its size, without streaming it
+	router.GET("/proxy-video/validate", limiter, func(c *gin.Context) {
+		videoUrl := c.Query("url")
+		if videoUrl == "" {
+			respondMissingParameter(c, "url")
+			return
+		}
+
+		check, err := services.CheckVideoURL(c.Request.Context(), videoUrl)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, check)
+	})
+
+	// Proxy endpoint for thumbnails that reject hotlinking. Not rate limited since a
+	// single grid loads many of them at once.
+	router.Match(proxyMethods, "/proxy-thumbnail", func(c *gin.Context) {
+		imageUrl := c.Query("url")
+		if imageUrl == "" {
+			respondMissingParameter(c, "url")
+			return
+		}
+
+		if err := services.ProxyThumbnail(c.Writer, c.Request, imageUrl); err != nil {
+			// Only report the error if nothing has been streamed yet
+			if !c.Writer.Written() {
+				respondError(c, err)
+			}
+			return
+		}
+	})
+
+	// Stand-in image for videos whose thumbnail is missing
+	router.GET("/thumbnail/placeholder", func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=86400")
+		c.Data(http.StatusOK, "image/svg+xml", []byte(services.PlaceholderThumbnail))
+	})
+
+	// Download endpoint that streams the video as an attachment
+	router.Match(proxyMethods, "/download", limiter, func(c *gin.Context) {
+		videoUrl := c.Query("url")
+		if videoUrl == "" {
+			respondMissingParameter(c, "url")
 			return
 		}
 
-		// Stream the video content to the client
-		c.Data(http.StatusOK, "video/mp4", videoContent)
+		// Name the file after the video page when the client passes it along
+		filename := services.DownloadFilename(c.Query("page"))
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+		if err := services.ProxyVideoContent(c.Writer, c.Request, videoUrl); err != nil {
+			// Only report the error if nothing has been streamed yet
+			if !c.Writer.Written() {
+				c.Writer.Header().Del("Content-Disposition")
+				respondError(c, err)
+			}
+			return
+		}
 	})
 
-	// Run the server on port 8080
-	router.Run(":8080")
+	// Run the server on PORT, defaulting to 8080
+	srv := &http.Server{
+		Addr:    ":" + getEnv("PORT", "8080"),
+		Handler: router,
+	}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Server failed: %v", err)
+		}
+	}()
+
+	// Wait for SIGINT/SIGTERM before shutting down
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	log.Println("Shutdown signal received, draining in-flight requests")
+
+	// Stop accepting connections and wait for active scrapes to finish
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Server did not drain in time: %v", err)
+	} else {
+		log.Println("All in-flight requests drained")
+	}
+
+	// Close Chrome last so no request is left without a browser
+	stopReaper()
+	closeAllocators()
+	log.Println("Browser allocators stopped, exiting")
+}
+
+// closeAllocators stops every Chrome process
+func closeAllocators() {
+	for _, allocator := range allocators {
+		allocator.Close()
+	}
 }
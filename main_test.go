@@ -0,0 +1,558 @@
+package main
+
+import (
+	"context"
+	"deimosbackend/services"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// serve sends a request through router from the client at remoteAddr
+func serve(router http.Handler, req *http.Request, remoteAddr string) *httptest.ResponseRecorder {
+	req.RemoteAddr = remoteAddr
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+// ok answers 200 with an empty JSON object
+func ok(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+func TestRateLimit(t *testing.T) {
+	router := gin.New()
+	router.GET("/search", rateLimit(newIPRateLimiter(1, 3)), ok)
+
+	// The burst goes through, the requests right after it do not
+	for i := 1; i <= 5; i++ {
+		recorder := serve(router, httptest.NewRequest("GET", "/search", nil), "192.0.2.1:1234")
+		want := http.StatusOK
+		if i > 3 {
+			want = http.StatusTooManyRequests
+		}
+		if recorder.Code != want {
+			t.Fatalf("request %d: status %d, want %d", i, recorder.Code, want)
+		}
+		if want == http.StatusTooManyRequests && recorder.Header().Get("Retry-After") == "" {
+			t.Fatalf("request %d: 429 without Retry-After", i)
+		}
+	}
+
+	// Other clients have buckets of their own
+	if recorder := serve(router, httptest.NewRequest("GET", "/search", nil), "192.0.2.2:1234"); recorder.Code != http.StatusOK {
+		t.Fatalf("another client got status %d, want 200", recorder.Code)
+	}
+}
+
+func TestStatusForError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{services.ErrEmptyQuery, http.StatusBadRequest},
+		{fmt.Errorf("%w: hashtag is required", services.ErrInvalidParameter), http.StatusBadRequest},
+		{services.ErrProfilePrivate, http.StatusForbidden},
+		{fmt.Errorf("%w: page starts at video 13 of 12", services.ErrNoMoreResults), http.StatusNotFound},
+		{services.ErrVideoNotFound, http.StatusNotFound},
+		{services.ErrBlocked, http.StatusTooManyRequests},
+		{services.ErrCaptchaRequired, http.StatusServiceUnavailable},
+		{services.ErrSelectorNotFound, http.StatusBadGateway},
+		{services.ErrScrapeTimeout, http.StatusGatewayTimeout},
+		{context.DeadlineExceeded, http.StatusGatewayTimeout},
+		{fmt.Errorf("received status code 500"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		if got := statusForError(tt.err); got != tt.want {
+			t.Errorf("statusForError(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{services.ErrEmptyQuery, "EMPTY_QUERY"},
+		{services.ErrInvalidURL, "INVALID_URL"},
+		{services.ErrInvalidParameter, "INVALID_PARAMETER"},
+		{services.ErrProfilePrivate, "PROFILE_PRIVATE"},
+		{services.ErrForbiddenTarget, "FORBIDDEN_TARGET"},
+		{services.ErrVideoNotFound, "VIDEO_NOT_FOUND"},
+		{services.ErrProfileNotFound, "PROFILE_NOT_FOUND"},
+		{services.ErrNoMoreResults, "NO_MORE_RESULTS"},
+		{services.ErrBlocked, "BLOCKED"},
+		{services.ErrCaptchaRequired, "CAPTCHA_REQUIRED"},
+		{services.ErrTabClosed, "BROWSER_UNAVAILABLE"},
+		{services.ErrUnexpectedContent, "UNEXPECTED_CONTENT"},
+		{services.ErrResponseTooLarge, "RESPONSE_TOO_LARGE"},
+		{services.ErrSelectorNotFound, "SELECTOR_NOT_FOUND"},
+		{services.ErrNavTimeout, "NAV_TIMEOUT"},
+		{services.ErrScrapeTimeout, "SCRAPE_TIMEOUT"},
+		{context.DeadlineExceeded, "TIMEOUT"},
+		{errors.New("received status code 500"), "INTERNAL"},
+	}
+	for _, tt := range tests {
+		// Codes must survive the wrapping the services add for context
+		wrapped := fmt.Errorf("scraping cats: %w", tt.err)
+		if got := errorCode(wrapped); got != tt.want {
+			t.Errorf("errorCode(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+
+	// Every mapped error must be covered above
+	if len(tests)-1 != len(errorMappings) {
+		t.Errorf("tested %d mapped errors, errorMappings has %d", len(tests)-1, len(errorMappings))
+	}
+}
+
+// decodeError reads the {"error": {...}} body of an error response
+func decodeError(t *testing.T, recorder *httptest.ResponseRecorder) apiError {
+	t.Helper()
+	var body struct {
+		Error apiError `json:"error"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("error body %q: %v", recorder.Body.String(), err)
+	}
+	return body.Error
+}
+
+func TestRespondError(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	respondError(c, fmt.Errorf("%w: received status code 404", services.ErrVideoNotFound))
+
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("status %d, want 404", recorder.Code)
+	}
+	body := decodeError(t, recorder)
+	if body.Code != "VIDEO_NOT_FOUND" || body.Message != "video not found: received status code 404" {
+		t.Fatalf("body %+v", body)
+	}
+}
+
+func TestCompression(t *testing.T) {
+	router := gin.New()
+	router.Use(compression())
+	router.GET("/search/:query", ok)
+	router.GET("/proxy-video", func(c *gin.Context) {
+		c.Data(http.StatusOK, "video/mp4", []byte("mp4 bytes"))
+	})
+	router.GET("/proxy-video/validate", ok)
+	router.GET("/search/stream/:query", func(c *gin.Context) {
+		c.SSEvent("done", gin.H{})
+	})
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/search/cats", "gzip"},
+		{"/proxy-video?url=https%3A%2F%2Fv16-webapp.tiktokcdn.com%2Fclip.mp4", ""},
+		{"/proxy-video/validate?url=https%3A%2F%2Fv16-webapp.tiktokcdn.com%2Fclip.mp4", "gzip"},
+		{"/search/stream/cats", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		recorder := serve(router, req, "192.0.2.1:1234")
+		if got := recorder.Header().Get("Content-Encoding"); got != tt.want {
+			t.Errorf("%s: Content-Encoding %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+// queryContext returns a gin context for a GET request with the given query string
+func queryContext(query string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/search/cats?"+query, nil)
+	return c
+}
+
+func TestParsePage(t *testing.T) {
+	tests := []struct {
+		query   string
+		page    int
+		invalid bool
+	}{
+		{"", 1, false},
+		{"page=3", 3, false},
+		{"page=0", 0, true},
+		{"page=-2", 0, true},
+		{"page=two", 0, true},
+		{"page=", 0, true},
+		{"page=1.5", 0, true},
+	}
+	for _, tt := range tests {
+		params, err := parseSearchParams(queryContext(tt.query))
+		if tt.invalid {
+			var pe *paramError
+			if !errors.As(err, &pe) || pe.Field != "page" {
+				t.Errorf("%q: err = %v, want a page paramError", tt.query, err)
+			}
+			continue
+		}
+		if err != nil || params.Page != tt.page {
+			t.Errorf("%q: page %d, err %v, want page %d", tt.query, params.Page, err, tt.page)
+		}
+	}
+}
+
+func TestParseSearchParamsBoundaries(t *testing.T) {
+	maxLimit := strconv.Itoa(services.MaxItemsPerPage)
+	overLimit := strconv.Itoa(services.MaxItemsPerPage + 1)
+	tests := []struct {
+		query string
+		field string // rejected field, empty when the query is valid
+	}{
+		{"limit=1", ""},
+		{"limit=" + maxLimit, ""},
+		{"limit=0", "limit"},
+		{"limit=" + overLimit, "limit"},
+		{"offset=0", ""},
+		{"offset=-1", "offset"},
+		{"offset=x", "offset"},
+		{"sortBy=likes", ""},
+		{"sortBy=views", "sortBy"},
+		{"dateRange=month", ""},
+		{"dateRange=year", "dateRange"},
+		{"sort=recent", ""},
+		{"sort=oldest", "sort"},
+		{"lang=en", ""},
+		{"lang=klingon", "lang"},
+		{"region=US", ""},
+		{"region=XX", "region"},
+	}
+	for _, tt := range tests {
+		_, err := parseSearchParams(queryContext(tt.query))
+		if tt.field == "" {
+			if err != nil {
+				t.Errorf("%q: unexpected error %v", tt.query, err)
+			}
+			continue
+		}
+		var pe *paramError
+		if !errors.As(err, &pe) || pe.Field != tt.field {
+			t.Errorf("%q: err = %v, want a %s paramError", tt.query, err, tt.field)
+		}
+	}
+}
+
+func TestParseSearchParamsOffset(t *testing.T) {
+	params, err := parseSearchParams(queryContext(""))
+	if err != nil || params.Offset != nil {
+		t.Fatalf("no offset: got %v, err %v, want nil", params.Offset, err)
+	}
+	params, err = parseSearchParams(queryContext("offset=0"))
+	if err != nil || params.Offset == nil || *params.Offset != 0 {
+		t.Fatalf("offset=0: got %v, err %v, want a zero offset", params.Offset, err)
+	}
+}
+
+func TestParseFeedParams(t *testing.T) {
+	params, err := parseFeedParams(queryContext("page=2&limit=12&offset=3&sort=views"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := params.PageOptions()
+	if params.Page != 2 || opts.Limit != 12 || opts.Offset == nil || *opts.Offset != 3 || params.Sort != "views" {
+		t.Fatalf("got %+v with options %+v", params, opts)
+	}
+
+	// Search filters are rejected rather than ignored
+	for _, query := range []string{"sortBy=likes", "dateRange=day", "lang=en", "region=US"} {
+		field, _, _ := strings.Cut(query, "=")
+		var pe *paramError
+		if _, err := parseFeedParams(queryContext(query)); !errors.As(err, &pe) || pe.Field != field {
+			t.Errorf("%q: err = %v, want a %s paramError", query, err, field)
+		}
+	}
+	if _, err := parseFeedParams(queryContext("limit=0")); err == nil {
+		t.Error("limit=0 accepted")
+	}
+}
+
+func TestSortResultCopies(t *testing.T) {
+	result := &services.SearchResult{Videos: []services.Video{
+		{VideoID: "1", Views: 10},
+		{VideoID: "2", Views: 20},
+	}}
+
+	sorted := SearchParams{Sort: "views"}.sortResult(result)
+	if sorted.Videos[0].VideoID != "2" {
+		t.Fatalf("sorted order %s, %s", sorted.Videos[0].VideoID, sorted.Videos[1].VideoID)
+	}
+	if result.Videos[0].VideoID != "1" {
+		t.Fatal("sorting changed the shared result")
+	}
+	if unsorted := (SearchParams{}).sortResult(result); unsorted != result {
+		t.Fatal("no sort still copied the result")
+	}
+}
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		query   string
+		limit   int
+		invalid bool
+	}{
+		{"", 0, false},
+		{"limit=1", 1, false},
+		{"limit=100", 100, false},
+		{"limit=101", 0, true},
+		{"limit=-5", 0, true},
+		{"limit=abc", 0, true},
+	}
+	for _, tt := range tests {
+		limit, err := parseLimit(queryContext(tt.query), 100)
+		if tt.invalid {
+			var pe *paramError
+			if !errors.As(err, &pe) || pe.Field != "limit" {
+				t.Errorf("%q: err = %v, want a limit paramError", tt.query, err)
+			}
+			continue
+		}
+		if err != nil || limit != tt.limit {
+			t.Errorf("%q: limit %d, err %v, want %d", tt.query, limit, err, tt.limit)
+		}
+	}
+}
+
+func TestRespondParamError(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest("GET", "/search/cats?limit=0", nil)
+
+	_, err := parseSearchParams(c)
+	respondParamError(c, err)
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400", recorder.Code)
+	}
+	if body := decodeError(t, recorder); body.Code != codeInvalidParameter || body.Field != "limit" {
+		t.Fatalf("body %+v, want %s on limit", body, codeInvalidParameter)
+	}
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	tests := []struct {
+		name   string
+		keys   string
+		path   string
+		header string
+		want   int
+	}{
+		{"valid header", "first, second", "/search/cats", "second", http.StatusOK},
+		{"valid query parameter", "first", "/search/cats?api_key=first", "", http.StatusOK},
+		{"missing key", "first", "/search/cats", "", http.StatusUnauthorized},
+		{"wrong key", "first", "/search/cats", "firs", http.StatusUnauthorized},
+		{"health stays open", "first", "/health", "", http.StatusOK},
+		{"disabled", "", "/search/cats", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		router := gin.New()
+		router.Use(apiKeyAuth(tt.keys))
+		router.GET("/search/:query", ok)
+		router.GET("/health", ok)
+
+		req := httptest.NewRequest("GET", tt.path, nil)
+		if tt.header != "" {
+			req.Header.Set("X-API-Key", tt.header)
+		}
+		if recorder := serve(router, req, "192.0.2.1:1234"); recorder.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, recorder.Code, tt.want)
+		}
+	}
+}
+
+func TestScrapeSlotsCapConcurrency(t *testing.T) {
+	slots := newScrapeSlots(2, 32)
+	var mu sync.Mutex
+	running, peak := 0, 0
+	router := gin.New()
+	router.GET("/search", slots.take(1), func(c *gin.Context) {
+		mu.Lock()
+		running++
+		peak = max(peak, running)
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		ok(c)
+	})
+
+	// Requests over the cap wait for a slot instead of failing
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if recorder := serve(router, httptest.NewRequest("GET", "/search", nil), "192.0.2.1:1234"); recorder.Code != http.StatusOK {
+				t.Errorf("status %d, want 200", recorder.Code)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if peak > 2 {
+		t.Fatalf("%d scrapes ran at once, the cap is 2", peak)
+	}
+}
+
+func TestScrapeSlotsWaitEndsWithRequest(t *testing.T) {
+	slots := newScrapeSlots(1, 32)
+	if !slots.sem.TryAcquire(1) {
+		t.Fatal("could not take the only slot")
+	}
+	defer slots.sem.Release(1)
+
+	handled := false
+	router := gin.New()
+	router.GET("/search", slots.take(1), func(c *gin.Context) {
+		handled = true
+		ok(c)
+	})
+
+	// The waiting request gives up when its context ends, leaving the response to requestTimeout
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	recorder := serve(router, httptest.NewRequest("GET", "/search", nil).WithContext(ctx), "192.0.2.1:1234")
+	if handled || recorder.Body.Len() != 0 {
+		t.Fatalf("handled %v with body %q, want the request aborted without a response", handled, recorder.Body.String())
+	}
+	if queued := slots.queued.Load(); queued != 0 {
+		t.Fatalf("%d requests still queued", queued)
+	}
+}
+
+func TestSetResultEmpty(t *testing.T) {
+	for _, empty := range []bool{true, false} {
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		setResultEmpty(c, &services.SearchResult{Empty: empty})
+
+		want := ""
+		if empty {
+			want = "true"
+		}
+		if got := recorder.Header().Get("X-Result-Empty"); got != want {
+			t.Errorf("empty %v: X-Result-Empty %q, want %q", empty, got, want)
+		}
+	}
+}
+
+func TestScrapeSlotsRejectWhenQueueFull(t *testing.T) {
+	slots := newScrapeSlots(1, 1)
+	release := make(chan struct{})
+	router := gin.New()
+	router.GET("/search", slots.take(1), func(c *gin.Context) {
+		<-release
+		ok(c)
+	})
+
+	// One request holds the only slot and another waits in the only queue spot
+	done := make(chan int, 2)
+	for range 2 {
+		go func() {
+			done <- serve(router, httptest.NewRequest("GET", "/search", nil), "192.0.2.1:1234").Code
+		}()
+	}
+	deadline := time.Now().Add(time.Second)
+	for slots.queued.Load() != 1 || slots.busy.Load() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("busy %d, queued %d, want 1 and 1", slots.busy.Load(), slots.queued.Load())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if stats := slots.stats(); stats["queued"] != int64(1) || stats["busy"] != int64(1) {
+		t.Fatalf("stats %v, want 1 busy and 1 queued", stats)
+	}
+
+	// The next one finds the queue full
+	recorder := serve(router, httptest.NewRequest("GET", "/search", nil), "192.0.2.1:1234")
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status %d, want 503", recorder.Code)
+	}
+	if recorder.Header().Get("Retry-After") == "" {
+		t.Fatal("503 without Retry-After")
+	}
+	if body := decodeError(t, recorder); body.Code != codeQueueFull {
+		t.Fatalf("code %s, want %s", body.Code, codeQueueFull)
+	}
+
+	// The queued request still gets its turn
+	close(release)
+	for range 2 {
+		if code := <-done; code != http.StatusOK {
+			t.Fatalf("status %d, want 200", code)
+		}
+	}
+}
+
+// waitOrDone sleeps for d, returning early with the context's error if it ends first
+func waitOrDone(c *gin.Context, d time.Duration) error {
+	select {
+	case <-time.After(d):
+		return nil
+	case <-c.Request.Context().Done():
+		return c.Request.Context().Err()
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	router := gin.New()
+	router.Use(requestTimeout(30 * time.Millisecond))
+	router.GET("/search", func(c *gin.Context) {
+		if waitOrDone(c, time.Second) == nil {
+			ok(c)
+		}
+	})
+	// Streams data for longer than the timeout, but never pauses for that long
+	router.GET("/proxy-video", func(c *gin.Context) {
+		for i := 0; i < 6; i++ {
+			if err := waitOrDone(c, 15*time.Millisecond); err != nil {
+				return
+			}
+			c.Writer.WriteString("chunk")
+			c.Writer.Flush()
+		}
+	})
+	router.GET("/download", func(c *gin.Context) {
+		waitOrDone(c, time.Second)
+	})
+
+	recorder := serve(router, httptest.NewRequest("GET", "/search", nil), "192.0.2.1:1234")
+	if recorder.Code != http.StatusGatewayTimeout {
+		t.Errorf("slow search: status %d, want 504", recorder.Code)
+	}
+
+	recorder = serve(router, httptest.NewRequest("GET", "/proxy-video", nil), "192.0.2.1:1234")
+	if got := recorder.Body.String(); got != "chunkchunkchunkchunkchunkchunk" {
+		t.Errorf("long stream: body %q, want all 6 chunks", got)
+	}
+
+	// A stream that stalls before sending anything still gets the 504
+	recorder = serve(router, httptest.NewRequest("GET", "/download", nil), "192.0.2.1:1234")
+	if recorder.Code != http.StatusGatewayTimeout {
+		t.Errorf("stalled download: status %d, want 504", recorder.Code)
+	}
+}
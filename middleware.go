@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"deimosbackend/services"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-contrib/gzip"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/sync/semaphore"
+	"golang.org/x/time/rate"
+)
+
+// corsMiddleware allows the comma-separated origins, or any origin when none are given
+func corsMiddleware(allowedOrigins string) gin.HandlerFunc {
+	var origins []string
+	for _, origin := range strings.Split(allowedOrigins, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+
+	// Fall back to the permissive defaults when no origins are configured
+	if len(origins) == 0 {
+		config := cors.DefaultConfig()
+		config.AllowAllOrigins = true
+		config.AddAllowHeaders("X-API-Key")
+		return cors.New(config)
+	}
+
+	return cors.New(cors.Config{
+		AllowOrigins:     origins,
+		AllowMethods:     []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodOptions},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Range", "Authorization", "X-API-Key"},
+		ExposeHeaders:    []string{"Content-Length", "Content-Range", "Accept-Ranges", "Retry-After", "X-Timing"},
+		AllowCredentials: true,
+		MaxAge:           12 * time.Hour,
+	})
+}
+
+// uncompressedRoutes matches the media and event stream routes, whole paths only since
+// JSON endpoints such as /proxy-video/validate share their prefix
+var uncompressedRoutes = []string{
+	`^/(proxy-video|proxy-thumbnail|download)(\?|$)`,
+	`^/search/stream/`,
+}
+
+// compression gzips responses for clients that accept it, except on uncompressedRoutes
+func compression() gin.HandlerFunc {
+	return gzip.Gzip(gzip.DefaultCompression, gzip.WithExcludedPathsRegexs(uncompressedRoutes))
+}
+
+// How long a client's limiter is kept after its last request
+const limiterIdleTTL = 10 * time.Minute
+
+// clientLimiter is a token bucket for a single client IP
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// ipRateLimiter hands out a token bucket per client IP
+type ipRateLimiter struct {
+	mu        sync.Mutex
+	clients   map[string]*clientLimiter
+	rps       rate.Limit
+	burst     int
+	lastSweep time.Time
+}
+
+// newIPRateLimiter allows each IP rps requests per second with the given burst
+func newIPRateLimiter(rps float64, burst int) *ipRateLimiter {
+	return &ipRateLimiter{
+		clients:   make(map[string]*clientLimiter),
+		rps:       rate.Limit(rps),
+		burst:     burst,
+		lastSweep: time.Now(),
+	}
+}
+
+// get returns the limiter for ip, forgetting clients that have gone idle
+func (l *ipRateLimiter) get(ip string) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastSweep) > time.Minute {
+		for key, client := range l.clients {
+			if now.Sub(client.lastSeen) > limiterIdleTTL {
+				delete(l.clients, key)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	client, ok := l.clients[ip]
+	if !ok {
+		client = &clientLimiter{limiter: rate.NewLimiter(l.rps, l.burst)}
+		l.clients[ip] = client
+	}
+	client.lastSeen = now
+	return client.limiter
+}
+
+// rateLimit rejects clients that exceed their token bucket with 429 and a Retry-After header
+func rateLimit(l *ipRateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		reservation := l.get(c.ClientIP()).Reserve()
+		if delay := reservation.Delay(); !reservation.OK() || delay > 0 {
+			// Give the token back, the request is rejected rather than delayed
+			reservation.Cancel()
+
+			retryAfter := int(math.Ceil(delay.Seconds()))
+			if retryAfter < 1 {
+				retryAfter = 1
+			}
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			writeError(c, http.StatusTooManyRequests, apiError{Code: codeRateLimited, Message: "rate limit exceeded"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// streamingRoutes stream media for as long as the video runs, so they get an idle timeout
+// instead of a total deadline that would cut long videos off mid-body
+var streamingRoutes = map[string]bool{
+	"/proxy-video": true,
+	"/download":    true,
+}
+
+// requestTimeout cancels the request context after timeout, so any scrape or upstream
+// fetch stops, and answers 504 if the handler had not responded by then
+func requestTimeout(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if streamingRoutes[c.FullPath()] {
+			idleTimeout(c, timeout)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && !c.Writer.Written() {
+			writeError(c, http.StatusGatewayTimeout, apiError{Code: codeTimeout, Message: "request timed out"})
+		}
+	}
+}
+
+// idleTimeout cancels the request context once the handler goes timeout without writing
+// any of the body, and answers 504 if that happens before the response started
+func idleTimeout(c *gin.Context, timeout time.Duration) {
+	ctx, cancel := context.WithCancelCause(c.Request.Context())
+	defer cancel(nil)
+	timer := time.AfterFunc(timeout, func() { cancel(context.DeadlineExceeded) })
+	defer timer.Stop()
+
+	c.Request = c.Request.WithContext(ctx)
+	c.Writer = &idleWriter{ResponseWriter: c.Writer, timer: timer, timeout: timeout}
+	c.Next()
+
+	if errors.Is(context.Cause(ctx), context.DeadlineExceeded) && !c.Writer.Written() {
+		writeError(c, http.StatusGatewayTimeout, apiError{Code: codeTimeout, Message: "request timed out"})
+	}
+}
+
+// idleWriter restarts the idle timer on every write
+type idleWriter struct {
+	gin.ResponseWriter
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func (w *idleWriter) Write(data []byte) (int, error) {
+	w.timer.Reset(w.timeout)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *idleWriter) WriteString(s string) (int, error) {
+	w.timer.Reset(w.timeout)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// timingHeaders records how long each scrape phase took and reports it in an X-Timing
+// header such as nav=820ms;wait=1200ms;parse=45ms;total=2100ms. Responses that did not
+// scrape get no header.
+func timingHeaders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, timing := services.WithTiming(c.Request.Context())
+		c.Request = c.Request.WithContext(ctx)
+		c.Writer = &timingWriter{ResponseWriter: c.Writer, timing: timing}
+		c.Next()
+	}
+}
+
+// timingWriter sets X-Timing just before the headers go out, once the scrape has run
+type timingWriter struct {
+	gin.ResponseWriter
+	timing *services.Timing
+}
+
+func (w *timingWriter) setHeader() {
+	if w.Written() {
+		return
+	}
+	if timing := w.timing.String(); timing != "" {
+		w.Header().Set("X-Timing", timing)
+	}
+}
+
+func (w *timingWriter) WriteHeaderNow() {
+	w.setHeader()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *timingWriter) Write(data []byte) (int, error) {
+	w.setHeader()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *timingWriter) WriteString(s string) (int, error) {
+	w.setHeader()
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *timingWriter) Flush() {
+	w.setHeader()
+	w.ResponseWriter.Flush()
+}
+
+// scrapeSlots caps how many scraping requests run at once across all routes, whatever
+// the size of the browser pool, so a burst cannot thrash the machine. Requests beyond
+// the limit queue in arrival order up to maxQueued.
+type scrapeSlots struct {
+	sem       *semaphore.Weighted
+	limit     int64
+	maxQueued int64
+	queued    atomic.Int64
+	busy      atomic.Int64
+}
+
+// newScrapeSlots allows limit concurrent scrape slots with up to maxQueued requests
+// waiting for one, or returns nil for no limit
+func newScrapeSlots(limit, maxQueued int64) *scrapeSlots {
+	if limit < 1 {
+		return nil
+	}
+	return &scrapeSlots{sem: semaphore.NewWeighted(limit), limit: limit, maxQueued: max(maxQueued, 0)}
+}
+
+// take holds weight slots while the rest of the chain runs. When none are free the
+// request waits in the queue until its context ends, leaving the 504 to requestTimeout,
+// or gets a 503 straight away if the queue is full.
+func (s *scrapeSlots) take(weight int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s == nil {
+			c.Next()
+			return
+		}
+
+		// A batch heavier than the whole limit would otherwise wait forever
+		weight := min(weight, s.limit)
+		if !s.sem.TryAcquire(weight) {
+			if !s.wait(c.Request.Context(), weight) {
+				if c.Request.Context().Err() == nil {
+					c.Header("Retry-After", "1")
+					writeError(c, http.StatusServiceUnavailable, apiError{Code: codeQueueFull, Message: "too many scrapes queued, retry later"})
+				}
+				c.Abort()
+				return
+			}
+		}
+		s.busy.Add(weight)
+		defer func() {
+			s.busy.Add(-weight)
+			s.sem.Release(weight)
+		}()
+		c.Next()
+	}
+}
+
+// wait queues for weight slots, false when the queue is full or ctx ends first
+func (s *scrapeSlots) wait(ctx context.Context, weight int64) bool {
+	if s.queued.Add(1) > s.maxQueued {
+		s.queued.Add(-1)
+		return false
+	}
+	defer s.queued.Add(-1)
+	return s.sem.Acquire(ctx, weight) == nil
+}
+
+// stats reports the slots in use and the requests waiting for one, for /stats
+func (s *scrapeSlots) stats() gin.H {
+	if s == nil {
+		return gin.H{"limit": 0}
+	}
+	return gin.H{
+		"limit":    s.limit,
+		"busy":     s.busy.Load(),
+		"queued":   s.queued.Load(),
+		"maxQueue": s.maxQueued,
+	}
+}
+
+// requestsServed counts every request handled since startup, reported by /stats
+var requestsServed atomic.Int64
+
+// countRequests increments requestsServed for every request
+func countRequests() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestsServed.Add(1)
+		c.Next()
+	}
+}
+
+// apiKeyAuth requires one of the comma-separated keys in the X-API-Key header or the
+// api_key query parameter on every route but /health. It does nothing when no keys are given.
+func apiKeyAuth(apiKeys string) gin.HandlerFunc {
+	var keys []string
+	for _, key := range strings.Split(apiKeys, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+
+	return func(c *gin.Context) {
+		if len(keys) == 0 || c.Request.URL.Path == "/health" {
+			c.Next()
+			return
+		}
+
+		provided := c.GetHeader("X-API-Key")
+		if provided == "" {
+			provided = c.Query("api_key")
+		}
+
+		// Compare in constant time so response timing does not leak key prefixes
+		for _, key := range keys {
+			if subtle.ConstantTimeCompare([]byte(provided), []byte(key)) == 1 {
+				c.Next()
+				return
+			}
+		}
+		writeError(c, http.StatusUnauthorized, apiError{Code: codeUnauthorized, Message: "missing or invalid API key"})
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"deimosbackend/services"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SearchParams holds the validated query parameters shared by the listing endpoints
+type SearchParams struct {
+	Page      int
+	Limit     int
+	Offset    *int
+	SortBy    string
+	DateRange string
+	Sort      string // server-side reordering of the returned page, empty to keep TikTok's
+	Lang      string
+	Region    string
+}
+
+// paramError reports which query parameter was rejected and why
+type paramError struct {
+	Field   string
+	Message string
+}
+
+func (e *paramError) Error() string {
+	return e.Field + " " + e.Message
+}
+
+// parseSearchParams reads page, limit, offset, sortBy, dateRange, sort, lang and region from the query
+// string. Absent parameters take their defaults while present but invalid ones are
+// rejected with a paramError naming the field.
+func parseSearchParams(c *gin.Context) (SearchParams, error) {
+	params := SearchParams{Page: 1}
+
+	if raw, ok := c.GetQuery("page"); ok {
+		page, err := strconv.Atoi(raw)
+		if err != nil || page < 1 {
+			return params, &paramError{"page", fmt.Sprintf("must be a positive integer, got %q", raw)}
+		}
+		params.Page = page
+	}
+
+	limit, err := parseLimit(c, services.MaxItemsPerPage)
+	if err != nil {
+		return params, err
+	}
+	params.Limit = limit
+
+	if raw, ok := c.GetQuery("offset"); ok {
+		offset, err := strconv.Atoi(raw)
+		if err != nil || offset < 0 {
+			return params, &paramError{"offset", fmt.Sprintf("must be a non-negative integer, got %q", raw)}
+		}
+		params.Offset = &offset
+	}
+
+	params.SortBy = c.Query("sortBy")
+	if params.SortBy != "" && !services.ValidSortBy(params.SortBy) {
+		return params, &paramError{"sortBy", fmt.Sprintf("must be relevance, likes or date, got %q", params.SortBy)}
+	}
+
+	params.DateRange = c.Query("dateRange")
+	if params.DateRange != "" && !services.ValidDateRange(params.DateRange) {
+		return params, &paramError{"dateRange", fmt.Sprintf("must be all, day, week or month, got %q", params.DateRange)}
+	}
+
+	params.Sort = c.Query("sort")
+	if params.Sort != "" && !services.ValidVideoSort(params.Sort) {
+		return params, &paramError{"sort", fmt.Sprintf("must be views, likes or recent, got %q", params.Sort)}
+	}
+
+	params.Lang = c.Query("lang")
+	if params.Lang != "" && !services.ValidLanguage(params.Lang) {
+		return params, &paramError{"lang", fmt.Sprintf("must be a supported language code such as en, got %q", params.Lang)}
+	}
+
+	params.Region = c.Query("region")
+	if params.Region != "" && !services.ValidRegion(params.Region) {
+		return params, &paramError{"region", fmt.Sprintf("must be a supported region code such as US, got %q", params.Region)}
+	}
+	return params, nil
+}
+
+// searchOnlyParams are the filters only TikTok's search understands
+var searchOnlyParams = []string{"sortBy", "dateRange", "lang", "region"}
+
+// parseFeedParams reads the parameters of the hashtag, trending, user and related feeds.
+// They take page, limit, offset and sort like search, but reject its search filters
+// rather than ignoring them.
+func parseFeedParams(c *gin.Context) (SearchParams, error) {
+	for _, name := range searchOnlyParams {
+		if _, ok := c.GetQuery(name); ok {
+			return SearchParams{Page: 1}, &paramError{name, "is only supported by search"}
+		}
+	}
+	return parseSearchParams(c)
+}
+
+// parseLimit reads the optional limit parameter, 0 when absent, rejecting anything
+// outside 1 to max with a paramError
+func parseLimit(c *gin.Context, max int) (int, error) {
+	raw, ok := c.GetQuery("limit")
+	if !ok {
+		return 0, nil
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit < 1 || limit > max {
+		return 0, &paramError{"limit", fmt.Sprintf("must be an integer between 1 and %d, got %q", max, raw)}
+	}
+	return limit, nil
+}
+
+// Options converts the parameters into the filters understood by the search service
+func (p SearchParams) Options() services.SearchOptions {
+	return services.SearchOptions{
+		SortBy:    p.SortBy,
+		DateRange: p.DateRange,
+		Limit:     p.Limit,
+		Offset:    p.Offset,
+		Lang:      p.Lang,
+		Region:    p.Region,
+	}
+}
+
+// PageOptions converts the parameters into the window of a feed
+func (p SearchParams) PageOptions() services.PageOptions {
+	return services.PageOptions{Limit: p.Limit, Offset: p.Offset}
+}
+
+// sortResult reorders the page by engagement on request, on a copy so a shared cached
+// result stays untouched. Only this page is sorted, the videos on each page stay those
+// TikTok returned there.
+func (p SearchParams) sortResult(result *services.SearchResult) *services.SearchResult {
+	if p.Sort == "" {
+		return result
+	}
+	sorted := *result
+	sorted.Videos = services.SortVideos(result.Videos, p.Sort)
+	return &sorted
+}
+
+// respondParamError writes a 400 naming the rejected field
+func respondParamError(c *gin.Context, err error) {
+	c.Header("Cache-Control", "no-store")
+	body := apiError{Code: codeInvalidParameter, Message: err.Error()}
+	if pe, ok := err.(*paramError); ok {
+		body.Field = pe.Field
+	}
+	writeError(c, http.StatusBadRequest, body)
+}
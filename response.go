@@ -0,0 +1,64 @@
+package main
+
+import (
+	"deimosbackend/services"
+	"encoding/json"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// selectVideoFields trims each video down to the comma-separated JSON fields requested.
+// Unknown names are ignored, and nil is returned when nothing valid was requested.
+func selectVideoFields(videos []services.Video, fields string) []map[string]any {
+	var wanted []string
+	for _, field := range strings.Split(fields, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			wanted = append(wanted, field)
+		}
+	}
+	if len(wanted) == 0 {
+		return nil
+	}
+
+	trimmed := make([]map[string]any, 0, len(videos))
+	matched := false
+	for _, video := range videos {
+		// Round-trip through JSON so the names match the regular response
+		var full map[string]any
+		raw, _ := json.Marshal(video)
+		json.Unmarshal(raw, &full)
+
+		selected := make(map[string]any)
+		for _, field := range wanted {
+			if value, ok := full[field]; ok {
+				selected[field] = value
+				matched = true
+			}
+		}
+		trimmed = append(trimmed, selected)
+	}
+
+	// Fall back to the full videos when none of the names were real fields
+	if !matched {
+		return nil
+	}
+	return trimmed
+}
+
+// setResultEmpty flags a genuinely empty result with X-Result-Empty, so clients can tell
+// "no results" apart from a broken scraper, which fails with SELECTOR_NOT_FOUND instead
+func setResultEmpty(c *gin.Context, result *services.SearchResult) {
+	if result.Empty {
+		c.Header("X-Result-Empty", "true")
+	}
+}
+
+// respondJSON writes obj as JSON, indented when the client asked for pretty=true
+func respondJSON(c *gin.Context, status int, obj any) {
+	if c.Query("pretty") == "true" {
+		c.IndentedJSON(status, obj)
+		return
+	}
+	c.JSON(status, obj)
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"github.com/chromedp/chromedp"
+)
+
+// AllocatorFailureThreshold is how many consecutive browser launch failures make the
+// supervisor replace the allocator
+var AllocatorFailureThreshold = 3
+
+// Allocator supervises the Chrome exec allocator shared by all tabs and recreates it
+// when it dies, so a crashed browser does not take the service down until a redeploy
+type Allocator struct {
+	parent context.Context
+	opts   []chromedp.ExecAllocatorOption
+
+	mu       sync.Mutex
+	ctx      context.Context
+	cancel   context.CancelFunc
+	failures int
+}
+
+// NewAllocator creates a supervised allocator with the given Chrome options
+func NewAllocator(parent context.Context, opts ...chromedp.ExecAllocatorOption) *Allocator {
+	a := &Allocator{parent: parent, opts: opts}
+	a.ctx, a.cancel = chromedp.NewExecAllocator(parent, opts...)
+	return a
+}
+
+// Context returns the current allocator context, recreating it first if it was cancelled
+func (a *Allocator) Context() context.Context {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.ctx.Err() != nil && a.parent.Err() == nil {
+		a.recreate("allocator context is done")
+	}
+	return a.ctx
+}
+
+// ReportFailure records a failed browser launch and recreates the allocator once
+// AllocatorFailureThreshold failures happened in a row
+func (a *Allocator) ReportFailure(err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.failures++
+	if a.failures >= AllocatorFailureThreshold && a.parent.Err() == nil {
+		a.recreate(err.Error())
+	}
+}
+
+// ReportSuccess resets the failure count after a successful browser launch
+func (a *Allocator) ReportSuccess() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.failures = 0
+}
+
+// Close stops the allocator and every browser started from it
+func (a *Allocator) Close() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.cancel()
+}
+
+// recreate replaces the allocator, cancelling the old one. The caller must hold a.mu.
+func (a *Allocator) recreate(reason string) {
+	log.Printf("Recovering browser allocator after %d failure(s): %s", a.failures, reason)
+	a.cancel()
+	a.ctx, a.cancel = chromedp.NewExecAllocator(a.parent, a.opts...)
+	a.failures = 0
+	allocatorRecoveries.Inc()
+}
+
+// allocatorSet spreads new tabs over several allocators in turn, so tab creation and
+// rendering are shared by as many Chrome processes
+type allocatorSet struct {
+	allocators []*Allocator
+	next       atomic.Uint64
+}
+
+// newAllocatorSet hands out tabs on allocators, which must not be empty
+func newAllocatorSet(allocators []*Allocator) *allocatorSet {
+	return &allocatorSet{allocators: allocators}
+}
+
+// newContext opens a tab context on the next allocator in turn, also returning that
+// allocator so launch failures can be reported to it
+func (s *allocatorSet) newContext() (context.Context, context.CancelFunc, *Allocator) {
+	allocator := s.allocators[(s.next.Add(1)-1)%uint64(len(s.allocators))]
+	ctx, cancel := chromedp.NewContext(allocator.Context())
+	return ctx, cancel, allocator
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/chromedp/chromedp"
+)
+
+func TestAllocatorFollowsParent(t *testing.T) {
+	parent, cancel := context.WithCancel(context.Background())
+	allocator := NewAllocator(parent)
+	defer allocator.Close()
+
+	tabCtx, cancelTab := chromedp.NewContext(allocator.Context())
+	defer cancelTab()
+
+	cancel()
+	if tabCtx.Err() == nil {
+		t.Fatal("tab context still live after the parent was cancelled")
+	}
+
+	// A cancelled parent means shutdown, so the allocator must not come back
+	if allocator.Context().Err() == nil {
+		t.Fatal("allocator was recreated after its parent was cancelled")
+	}
+}
+
+func TestAllocatorRecreatedWhileParentLive(t *testing.T) {
+	allocator := NewAllocator(context.Background())
+	defer allocator.Close()
+
+	first := allocator.Context()
+	allocator.Close()
+	if first.Err() == nil {
+		t.Fatal("closing the allocator left its context live")
+	}
+	if allocator.Context().Err() != nil {
+		t.Fatal("dead allocator was not recreated under a live parent")
+	}
+}
+
+func TestAllocatorSetRoundRobin(t *testing.T) {
+	allocators := []*Allocator{NewAllocator(context.Background()), NewAllocator(context.Background()), NewAllocator(context.Background())}
+	set := newAllocatorSet(allocators)
+
+	// Each new tab goes to the next allocator in turn, wrapping around
+	counts := make(map[*Allocator]int)
+	var tabs []context.Context
+	for i := range 7 {
+		ctx, cancel, allocator := set.newContext()
+		defer cancel()
+		if want := allocators[i%len(allocators)]; allocator != want {
+			t.Fatalf("tab %d went to allocator %p, want %p", i, allocator, want)
+		}
+		counts[allocator]++
+		tabs = append(tabs, ctx)
+	}
+	for i, allocator := range allocators {
+		if want := []int{3, 2, 2}[i]; counts[allocator] != want {
+			t.Errorf("allocator %d got %d tabs, want %d", i, counts[allocator], want)
+		}
+	}
+
+	// Closing every allocator on shutdown stops the tabs on all of them
+	for _, allocator := range allocators {
+		allocator.Close()
+	}
+	for i, ctx := range tabs {
+		if ctx.Err() == nil {
+			t.Errorf("tab %d still live after shutdown", i)
+		}
+	}
+}
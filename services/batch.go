@@ -0,0 +1,99 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// BatchConcurrency caps how many items of a batch are resolved at the same time
+var BatchConcurrency = 4
+
+// BatchError collects the per-item failures of a batch that otherwise succeeded
+type BatchError struct {
+	Errors map[string]error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("%d batch item(s) failed", len(e.Errors))
+}
+
+// runBatch calls fn for every unique key using BatchConcurrency workers and
+// returns the failures as a *BatchError, or nil when every item succeeded
+func runBatch(ctx context.Context, keys []string, fn func(ctx context.Context, key string) error) error {
+	jobs := make(chan string)
+	failures := make(map[string]error)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for i := 0; i < BatchConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range jobs {
+				if err := fn(ctx, key); err != nil {
+					mu.Lock()
+					failures[key] = err
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	// Feed each key once, even if the caller repeated it
+	seen := make(map[string]struct{})
+	for _, key := range keys {
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		jobs <- key
+	}
+	close(jobs)
+	wg.Wait()
+
+	if len(failures) > 0 {
+		return &BatchError{Errors: failures}
+	}
+	return nil
+}
+
+// GetVideoUrls resolves several video pages concurrently, returning a map from page URL
+// to direct video URL. Items that fail are reported through a *BatchError.
+func GetVideoUrls(ctx context.Context, pageUrls []string) (map[string]string, error) {
+	videoUrls := make(map[string]string)
+	var mu sync.Mutex
+
+	err := runBatch(ctx, pageUrls, func(ctx context.Context, pageUrl string) error {
+		videoUrl, _, err := GetVideoUrl(ctx, pageUrl, "")
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		videoUrls[pageUrl] = videoUrl
+		mu.Unlock()
+		return nil
+	})
+	return videoUrls, err
+}
+
+// SearchMany runs several searches concurrently, returning a map from query to the
+// videos on the requested page. Queries that fail are reported through a *BatchError.
+func SearchMany(ctx context.Context, queries []string, page int, opts SearchOptions) (map[string][]Video, error) {
+	results := make(map[string][]Video)
+	var mu sync.Mutex
+
+	err := runBatch(ctx, queries, func(ctx context.Context, query string) error {
+		result, err := SearchTikTokVideos(ctx, query, page, opts)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		results[query] = result.Videos
+		mu.Unlock()
+		return nil
+	})
+	return results, err
+}
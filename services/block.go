@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+)
+
+// BlockedResourceTypes are the kinds of requests tabs refuse while scraping, since the
+// scrapers read the markup and never need them loaded. Images are still let through on
+// feeds, whose thumbnails are lazily loaded.
+var BlockedResourceTypes = []network.ResourceType{
+	network.ResourceTypeImage,
+	network.ResourceTypeFont,
+	network.ResourceTypeMedia,
+}
+
+// BlockedDomains are analytics and ad hosts tabs never contact, subdomains included
+var BlockedDomains = []string{
+	"google-analytics.com",
+	"googletagmanager.com",
+	"doubleclick.net",
+	"connect.facebook.net",
+	"analytics.tiktok.com",
+}
+
+// ParseResourceTypes reads a comma-separated list of CDP resource types such as
+// "image,font", in any case. The document itself cannot be blocked.
+func ParseResourceTypes(raw string) ([]network.ResourceType, error) {
+	known := []network.ResourceType{
+		network.ResourceTypeStylesheet, network.ResourceTypeImage, network.ResourceTypeMedia,
+		network.ResourceTypeFont, network.ResourceTypeScript, network.ResourceTypeTextTrack,
+		network.ResourceTypeXHR, network.ResourceTypeFetch, network.ResourceTypePrefetch,
+		network.ResourceTypeEventSource, network.ResourceTypeWebSocket, network.ResourceTypeManifest,
+		network.ResourceTypePing, network.ResourceTypeOther,
+	}
+
+	var types []network.ResourceType
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		found := false
+		for _, resourceType := range known {
+			if strings.EqualFold(name, string(resourceType)) {
+				types = append(types, resourceType)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown resource type %q", name)
+		}
+	}
+	return types, nil
+}
+
+// blockResources makes the tab fail every request for BlockedResourceTypes or to
+// BlockedDomains until the next call, letting images through when keepImages is set
+func (t *pooledTab) blockResources(ctx context.Context, keepImages bool) error {
+	patterns := blockPatterns(keepImages)
+	if len(patterns) == 0 {
+		return t.run(ctx, fetch.Disable())
+	}
+	return t.run(ctx, fetch.Enable().WithPatterns(patterns))
+}
+
+// blockPatterns returns the request patterns paused for blockResources
+func blockPatterns(keepImages bool) []*fetch.RequestPattern {
+	var patterns []*fetch.RequestPattern
+	for _, resourceType := range BlockedResourceTypes {
+		if keepImages && resourceType == network.ResourceTypeImage {
+			continue
+		}
+		patterns = append(patterns, &fetch.RequestPattern{URLPattern: "*", ResourceType: resourceType})
+	}
+	for _, domain := range BlockedDomains {
+		patterns = append(patterns,
+			&fetch.RequestPattern{URLPattern: "*://" + domain + "/*"},
+			&fetch.RequestPattern{URLPattern: "*://*." + domain + "/*"},
+		)
+	}
+	return patterns
+}
+
+// failBlockedRequests fails the requests paused by blockResources for as long as the
+// tab in ctx lives. Only blocked requests are paused, so every one of them is failed.
+func failBlockedRequests(ctx context.Context) {
+	chromedp.ListenTarget(ctx, func(ev any) {
+		paused, ok := ev.(*fetch.EventRequestPaused)
+		if !ok {
+			return
+		}
+
+		// Calling back into the browser from the listener itself would deadlock
+		go func() {
+			executorCtx := cdp.WithExecutor(ctx, chromedp.FromContext(ctx).Target)
+			if err := fetch.FailRequest(paused.RequestID, network.ErrorReasonBlockedByClient).Do(executorCtx); err == nil {
+				blockedRequestsTotal.Inc()
+			}
+		}()
+	})
+}
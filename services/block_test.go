@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+)
+
+func TestParseResourceTypes(t *testing.T) {
+	types, err := ParseResourceTypes(" Image,font ,,media")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []network.ResourceType{network.ResourceTypeImage, network.ResourceTypeFont, network.ResourceTypeMedia}
+	if len(types) != len(want) {
+		t.Fatalf("got %v, want %v", types, want)
+	}
+	for i := range want {
+		if types[i] != want[i] {
+			t.Fatalf("got %v, want %v", types, want)
+		}
+	}
+
+	// The page itself cannot be blocked
+	if _, err := ParseResourceTypes("document"); err == nil {
+		t.Fatal("document was accepted")
+	}
+}
+
+func TestBlockPatterns(t *testing.T) {
+	blocksImages := func(keepImages bool) bool {
+		for _, pattern := range blockPatterns(keepImages) {
+			if pattern.ResourceType == network.ResourceTypeImage {
+				return true
+			}
+		}
+		return false
+	}
+	if !blocksImages(false) {
+		t.Fatal("images are not blocked")
+	}
+	if blocksImages(true) {
+		t.Fatal("images are blocked on a feed that needs its thumbnails")
+	}
+
+	// Trackers are blocked with and without their subdomains
+	urls := make(map[string]bool)
+	for _, pattern := range blockPatterns(true) {
+		urls[pattern.URLPattern] = true
+	}
+	for _, want := range []string{"*://doubleclick.net/*", "*://*.doubleclick.net/*"} {
+		if !urls[want] {
+			t.Errorf("no %s pattern", want)
+		}
+	}
+}
+
+func TestBlockedRequestsAreAborted(t *testing.T) {
+	usePool(t, 1)
+
+	var imageHits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/pixel.png" {
+			imageHits.Add(1)
+			w.Header().Set("Content-Type", "image/png")
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body><img src="/pixel.png"></body></html>`))
+	}))
+	defer server.Close()
+
+	load := func(keepImages bool) {
+		tab, err := browserPool.Acquire(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer browserPool.Release(tab)
+
+		runCtx, cancel := tab.scrapeContext(context.Background())
+		defer cancel()
+		if err := tab.blockResources(runCtx, keepImages); err != nil {
+			t.Fatal(err)
+		}
+		if err := tab.run(runCtx, chromedp.Navigate(server.URL)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The image never reaches the server while images are blocked
+	load(false)
+	if n := imageHits.Load(); n != 0 {
+		t.Fatalf("blocked image was requested %d times", n)
+	}
+
+	load(true)
+	if imageHits.Load() == 0 {
+		t.Fatal("image was not requested with images let through")
+	}
+}
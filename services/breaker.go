@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// BreakerThreshold is how many consecutive scrape failures trip the circuit breaker
+var BreakerThreshold = 5
+
+// BreakerCooldown is how long the breaker fast-fails before letting a probe through
+var BreakerCooldown = time.Minute
+
+// Circuit breaker states, also used as the value of the breaker metric
+const (
+	breakerClosed = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// circuitBreaker stops sending scrapes to TikTok after repeated failures, which
+// usually mean it is blocking us, instead of burning a tab for the full timeout
+type circuitBreaker struct {
+	mu       sync.Mutex
+	state    int
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// scrapeBreaker guards every browser scrape
+var scrapeBreaker = &circuitBreaker{}
+
+// allow reports whether a scrape may run, letting a single probe through once the
+// cooldown is over
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerOpen && time.Since(b.openedAt) >= BreakerCooldown {
+		b.setState(breakerHalfOpen)
+	}
+
+	switch {
+	case b.state == breakerOpen:
+		return fmt.Errorf("%w: scraping paused after %d consecutive failures", ErrBlocked, b.failures)
+	case b.state == breakerHalfOpen && b.probing:
+		return fmt.Errorf("%w: scraping paused while checking whether TikTok recovered", ErrBlocked)
+	case b.state == breakerHalfOpen:
+		b.probing = true
+	}
+	return nil
+}
+
+// record updates the breaker with the outcome of a scrape that allow let through
+func (b *circuitBreaker) record(err error) {
+	// Bad input, missing content and clients going away say nothing about TikTok's health
+	if err != nil && !countsAsScrapeFailure(err) {
+		err = nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if err == nil {
+		b.failures = 0
+		b.setState(breakerClosed)
+		return
+	}
+
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= BreakerThreshold {
+		b.openedAt = time.Now()
+		b.setState(breakerOpen)
+	}
+}
+
+// setState changes the state and mirrors it in the metric. The caller must hold b.mu.
+func (b *circuitBreaker) setState(state int) {
+	b.state = state
+	breakerState.Set(float64(state))
+}
+
+// State returns the breaker state as closed, open or half-open
+func (b *circuitBreaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// BreakerState reports the state of the scrape circuit breaker
+func BreakerState() string {
+	return scrapeBreaker.State()
+}
+
+// countsAsScrapeFailure reports whether err suggests TikTok is blocking or failing. Only
+// our own ErrScrapeTimeout and ErrNavTimeout count as timeouts, the caller running out of
+// its own deadline says nothing about TikTok.
+func countsAsScrapeFailure(err error) bool {
+	switch {
+	case errors.Is(err, context.Canceled),
+		errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, ErrInvalidURL),
+		errors.Is(err, ErrInvalidParameter),
+		errors.Is(err, ErrEmptyQuery),
+		errors.Is(err, ErrProfileNotFound),
+		errors.Is(err, ErrProfilePrivate),
+		errors.Is(err, ErrVideoNotFound),
+		errors.Is(err, ErrNoMoreResults):
+		return false
+	}
+	return true
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// setBreaker sets the breaker threshold and cooldown for the duration of the test
+func setBreaker(t *testing.T, threshold int, cooldown time.Duration) {
+	t.Helper()
+	originalThreshold, originalCooldown := BreakerThreshold, BreakerCooldown
+	BreakerThreshold, BreakerCooldown = threshold, cooldown
+	t.Cleanup(func() {
+		BreakerThreshold, BreakerCooldown = originalThreshold, originalCooldown
+	})
+}
+
+// fail runs one scrape through b that fails with err
+func fail(t *testing.T, b *circuitBreaker, err error) {
+	t.Helper()
+	if allowErr := b.allow(); allowErr != nil {
+		t.Fatalf("scrape refused: %v", allowErr)
+	}
+	b.record(err)
+}
+
+func TestBreakerTransitions(t *testing.T) {
+	setBreaker(t, 3, 20*time.Millisecond)
+	b := &circuitBreaker{}
+
+	// Closed until the threshold is reached
+	for range 2 {
+		fail(t, b, ErrBlocked)
+	}
+	if b.State() != "closed" {
+		t.Fatalf("state %s after 2 failures, want closed", b.State())
+	}
+	fail(t, b, ErrScrapeTimeout)
+	if b.State() != "open" {
+		t.Fatalf("state %s after 3 failures, want open", b.State())
+	}
+
+	// Open fast-fails with ErrBlocked until the cooldown is over
+	if err := b.allow(); !errors.Is(err, ErrBlocked) {
+		t.Fatalf("allow while open = %v, want ErrBlocked", err)
+	}
+	time.Sleep(25 * time.Millisecond)
+
+	// Half-open lets a single probe through
+	if err := b.allow(); err != nil {
+		t.Fatalf("probe refused: %v", err)
+	}
+	if b.State() != "half-open" {
+		t.Fatalf("state %s after the cooldown, want half-open", b.State())
+	}
+	if err := b.allow(); !errors.Is(err, ErrBlocked) {
+		t.Fatalf("second scrape during the probe = %v, want ErrBlocked", err)
+	}
+
+	// A failed probe opens it again, a successful one closes it
+	b.record(ErrCaptchaRequired)
+	if b.State() != "open" {
+		t.Fatalf("state %s after a failed probe, want open", b.State())
+	}
+	time.Sleep(25 * time.Millisecond)
+	if err := b.allow(); err != nil {
+		t.Fatalf("probe refused: %v", err)
+	}
+	b.record(nil)
+	if b.State() != "closed" {
+		t.Fatalf("state %s after a successful probe, want closed", b.State())
+	}
+}
+
+func TestBreakerIgnoresCallerFailures(t *testing.T) {
+	setBreaker(t, 2, time.Minute)
+	b := &circuitBreaker{}
+
+	for _, err := range []error{
+		context.Canceled,
+		context.DeadlineExceeded,
+		fmt.Errorf("acquiring a tab: %w", context.DeadlineExceeded),
+		fmt.Errorf("%w: hashtag is required", ErrInvalidParameter),
+		ErrVideoNotFound,
+		ErrNoMoreResults,
+	} {
+		fail(t, b, err)
+		fail(t, b, err)
+		if b.State() != "closed" {
+			t.Fatalf("%v tripped the breaker", err)
+		}
+	}
+
+	// Our own timeouts do count
+	fail(t, b, ErrNavTimeout)
+	fail(t, b, ErrScrapeTimeout)
+	if b.State() != "open" {
+		t.Fatalf("state %s after two scrape timeouts, want open", b.State())
+	}
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SearchCacheTTL controls how long search results are served from memory
+var SearchCacheTTL = 5 * time.Minute
+
+// cacheEntry holds a cached search result and when it expires
+type cacheEntry struct {
+	result    *SearchResult
+	expiresAt time.Time
+}
+
+// searchCache is an in-memory TTL cache of search results keyed by query, page and filters
+type searchCache struct {
+	mu      sync.RWMutex
+	entries map[string]cacheEntry
+}
+
+var resultsCache = &searchCache{entries: make(map[string]cacheEntry)}
+
+// searchCacheKey builds the cache key for a query, page and filters
+func searchCacheKey(query string, page int, opts SearchOptions) string {
+	// An offset replaces the page, so it gets its own key space
+	if opts.Offset != nil {
+		return fmt.Sprintf("%s|@%d|%d|%s|%s|%s|%s", query, *opts.Offset, opts.Limit, opts.SortBy, opts.DateRange, opts.Lang, opts.Region)
+	}
+	return fmt.Sprintf("%s|%d|%d|%s|%s|%s|%s", query, page, opts.Limit, opts.SortBy, opts.DateRange, opts.Lang, opts.Region)
+}
+
+// get returns the cached result for key if it has not expired
+func (c *searchCache) get(key string) (*SearchResult, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		cacheMisses.Add(1)
+		return nil, false
+	}
+	cacheHits.Add(1)
+	return entry.result, true
+}
+
+// set stores a result for key and evicts any expired entries
+func (c *searchCache) set(key string, result *SearchResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for k, entry := range c.entries {
+		if now.After(entry.expiresAt) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = cacheEntry{result: result, expiresAt: now.Add(SearchCacheTTL)}
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// stubSearch replaces the search scraper with scrape and empties the search cache for
+// the duration of the test
+func stubSearch(t *testing.T, scrape func(ctx context.Context, query string, page int, opts SearchOptions, emit func(Video)) (*SearchResult, error)) {
+	t.Helper()
+
+	original := searchScraper
+	searchScraper = scrape
+	resultsCache = &searchCache{entries: make(map[string]cacheEntry)}
+	t.Cleanup(func() {
+		searchScraper = original
+		resultsCache = &searchCache{entries: make(map[string]cacheEntry)}
+	})
+}
+
+func TestSearchCacheServesRepeatQueries(t *testing.T) {
+	var scrapes atomic.Int32
+	stubSearch(t, func(ctx context.Context, query string, page int, opts SearchOptions, emit func(Video)) (*SearchResult, error) {
+		scrapes.Add(1)
+		return &SearchResult{Videos: []Video{{VideoID: "1"}}, Page: page}, nil
+	})
+
+	first, err := SearchTikTokVideos(context.Background(), "cats", 1, SearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := SearchTikTokVideos(context.Background(), "cats", 1, SearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := scrapes.Load(); n != 1 {
+		t.Fatalf("scraper ran %d times, want 1", n)
+	}
+	if first.FromCache || !second.FromCache {
+		t.Fatalf("FromCache = %v, %v, want false, true", first.FromCache, second.FromCache)
+	}
+
+	// Another page is another key
+	if _, err := SearchTikTokVideos(context.Background(), "cats", 2, SearchOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if n := scrapes.Load(); n != 2 {
+		t.Fatalf("scraper ran %d times after a new page, want 2", n)
+	}
+}
+
+func TestSearchCacheExpiry(t *testing.T) {
+	cache := &searchCache{entries: make(map[string]cacheEntry)}
+	cache.entries["old"] = cacheEntry{result: &SearchResult{}, expiresAt: time.Now().Add(-time.Second)}
+
+	if _, ok := cache.get("old"); ok {
+		t.Fatal("expired entry was served")
+	}
+
+	cache.set("new", &SearchResult{})
+	if _, ok := cache.entries["old"]; ok {
+		t.Fatal("expired entry was not evicted on set")
+	}
+	if _, ok := cache.get("new"); !ok {
+		t.Fatal("fresh entry was not served")
+	}
+}
+
+func TestConcurrentSearchesShareOneScrape(t *testing.T) {
+	var scrapes atomic.Int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	stubSearch(t, func(ctx context.Context, query string, page int, opts SearchOptions, emit func(Video)) (*SearchResult, error) {
+		if scrapes.Add(1) == 1 {
+			close(started)
+		}
+		<-release
+		return &SearchResult{Videos: []Video{{VideoID: "1"}}, Page: page}, nil
+	})
+
+	const callers = 8
+	results := make(chan *SearchResult, callers)
+	errs := make(chan error, callers)
+	for range callers {
+		go func() {
+			result, err := SearchTikTokVideos(context.Background(), "trending", 1, SearchOptions{})
+			if err != nil {
+				errs <- err
+				return
+			}
+			results <- result
+		}()
+	}
+
+	// Let every caller join the flight before the scrape finishes
+	<-started
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+
+	var shared *SearchResult
+	for range callers {
+		select {
+		case err := <-errs:
+			t.Fatal(err)
+		case result := <-results:
+			if result.FromCache {
+				t.Fatal("a caller was served from the cache instead of the shared scrape")
+			}
+			if shared == nil {
+				shared = result
+			} else if result != shared {
+				t.Fatal("callers received different results")
+			}
+		}
+	}
+
+	if n := scrapes.Load(); n != 1 {
+		t.Fatalf("scraper ran %d times, want 1", n)
+	}
+}
@@ -0,0 +1,36 @@
+package services
+
+import (
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// captchaMarkers are the containers TikTok renders for its "verify to continue" interstitial
+var captchaMarkers = []pageMarker{
+	{selector: `#captcha-verify-container`, err: ErrCaptchaRequired},
+	{selector: `.captcha_verify_container`, err: ErrCaptchaRequired},
+	{selector: `#tiktok-verify-ele`, err: ErrCaptchaRequired},
+}
+
+// captchaSelector joins the captcha markers into one selector for waits
+func captchaSelector() string {
+	selectors := make([]string, 0, len(captchaMarkers))
+	for _, marker := range captchaMarkers {
+		selectors = append(selectors, marker.selector)
+	}
+	return strings.Join(selectors, ", ")
+}
+
+// isCaptchaPage reports whether doc is a verification interstitial rather than content
+func isCaptchaPage(doc *goquery.Document) bool {
+	for _, marker := range captchaMarkers {
+		if doc.Find(marker.selector).Length() > 0 {
+			return true
+		}
+	}
+
+	// The containers change names now and then, the wording rarely does
+	text := strings.ToLower(doc.Find("body").Text())
+	return strings.Contains(text, "verify to continue")
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/chromedp/chromedp"
+)
+
+// Default and maximum number of comments returned by GetVideoComments
+const (
+	defaultCommentLimit = 20
+	MaxCommentLimit     = 100
+)
+
+// Comment is a top-level comment on a video
+type Comment struct {
+	Author    string `json:"author"`
+	Text      string `json:"text"`
+	Likes     int    `json:"likes"`
+	Timestamp string `json:"timestamp"` // As displayed by TikTok, e.g. "2d ago"
+}
+
+// GetVideoComments scrapes up to limit top-level comments from a video page. Videos with
+// comments disabled or without comments return an empty slice.
+func GetVideoComments(ctx context.Context, videoPageUrl string, limit int) ([]Comment, error) {
+	if _, err := url.ParseRequestURI(videoPageUrl); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidURL, videoPageUrl)
+	}
+	if limit < 1 {
+		limit = defaultCommentLimit
+	}
+	limit = min(limit, MaxCommentLimit)
+
+	if err := scrapeBreaker.allow(); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	comments, err := onFreshTab(ctx, func() ([]Comment, error) {
+		return scrapeComments(ctx, videoPageUrl, limit)
+	})
+	observeScrape("comments", start, err)
+	scrapeBreaker.record(err)
+	return comments, err
+}
+
+// scrapeComments loads the video page in a pooled tab and scrolls its comment list
+func scrapeComments(ctx context.Context, videoPageUrl string, limit int) ([]Comment, error) {
+	comments := []Comment{}
+
+	// Borrow a tab from the browser pool
+	tab, err := browserPool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer browserPool.Release(tab)
+
+	// Bound the scrape so a slow page or a client disconnect cannot hang the tab
+	runCtx, cancel := tab.scrapeContext(ctx)
+	defer cancel()
+
+	// Comments are read from the markup, so nothing needs to load but the page itself
+	if err := tab.blockResources(runCtx, false); err != nil {
+		return nil, err
+	}
+
+	// Wait for the comments, the "no comments" placeholder or a captcha
+	waitSelector := selectors.CommentList + ", " + selectors.CommentEmpty
+	for _, marker := range captchaMarkers {
+		waitSelector += ", " + marker.selector
+	}
+
+	navCtx, cancelNav := navContext(runCtx)
+	err = withRetry(navCtx, func() error {
+		return tab.run(navCtx,
+			chromedp.Navigate(videoPageUrl),
+			chromedp.WaitVisible(waitSelector, chromedp.ByQuery),
+		)
+	})
+	cancelNav()
+	if err != nil {
+		log.Printf("Error while loading comments of %s: %v", videoPageUrl, err)
+		return nil, err
+	}
+
+	// Scroll until enough comments are loaded or the list stops growing
+	var htmlContent string
+	var progress scrollProgress
+	for progress.more(limit) {
+		actions := []chromedp.Action{}
+		if progress.scrolls > 0 {
+			actions = append(actions,
+				chromedp.Evaluate(`window.scrollTo(0, document.body.scrollHeight)`, nil),
+				settle(),
+			)
+		}
+		actions = append(actions, chromedp.OuterHTML("html", &htmlContent))
+
+		if err := tab.run(runCtx, actions...); err != nil {
+			return nil, err
+		}
+
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(htmlContent))
+		if err != nil {
+			log.Printf("Failed to parse HTML: %v", err)
+			return nil, err
+		}
+
+		if doc.Find(selectors.CommentList).Length() == 0 {
+			if isCaptchaPage(doc) {
+				return nil, ErrCaptchaRequired
+			}
+			// Comments are disabled or there are none yet
+			return comments, nil
+		}
+
+		comments = extractComments(doc, limit)
+		progress.record(len(comments))
+	}
+
+	return comments, nil
+}
+
+// extractComments parses up to limit comments from the comment list in doc
+func extractComments(doc *goquery.Document, limit int) []Comment {
+	comments := []Comment{}
+
+	doc.Find(selectors.CommentItem).EachWithBreak(func(i int, s *goquery.Selection) bool {
+		if len(comments) >= limit {
+			return false
+		}
+
+		text := strings.TrimSpace(s.Find(selectors.CommentText).First().Text())
+		if text == "" {
+			return true // Skip stickers and other comments without text
+		}
+
+		comments = append(comments, Comment{
+			Author:    strings.TrimSpace(s.Find(selectors.CommentAuthor).First().Text()),
+			Text:      text,
+			Likes:     extractCount(s, selectors.CommentLikes),
+			Timestamp: strings.TrimSpace(s.Find(selectors.CommentTime).First().Text()),
+		})
+		return true
+	})
+
+	return comments
+}
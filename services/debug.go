@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// FetchPageHTML returns the HTML TikTok rendered for pageUrl, loaded the same way the
+// scrapers load pages. It is meant for diagnosing broken selectors.
+func FetchPageHTML(ctx context.Context, pageUrl string) (string, error) {
+	if err := checkDebugURL(pageUrl); err != nil {
+		return "", err
+	}
+	return loadPageHTML(ctx, pageUrl, "body")
+}
+
+// checkDebugURL only accepts TikTok pages, so the debug endpoints cannot be used to
+// browse arbitrary sites
+func checkDebugURL(pageUrl string) error {
+	parsedURL, err := url.ParseRequestURI(pageUrl)
+	if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || !isTikTokHost(parsedURL.Hostname()) {
+		return fmt.Errorf("%w: %s", ErrInvalidURL, pageUrl)
+	}
+	return nil
+}
+
+// RawCard holds the values read from one video card before any normalization, next to
+// the Video they were turned into
+type RawCard struct {
+	Feed         string `json:"feed"` // Which feed's item selector matched the card
+	Href         string `json:"href"`
+	ImgSrc       string `json:"imgSrc"`
+	ImgDataSrc   string `json:"imgDataSrc"`
+	ImgAlt       string `json:"imgAlt"`
+	CaptionHTML  string `json:"captionHtml"`
+	UserHref     string `json:"userHref"`
+	ViewCount    string `json:"viewCount"`
+	LikeCount    string `json:"likeCount"`
+	CommentCount string `json:"commentCount"`
+	Video        *Video `json:"video"` // nil when the card was skipped
+}
+
+// rawCard reads the raw values of card s. Search cards keep their caption and author in
+// the next sibling, so it is searched as well.
+func rawCard(s *goquery.Selection, video Video, parsed bool) RawCard {
+	card := s.AddSelection(s.Next())
+	img := s.Find("img").First()
+	text := func(selector string) string {
+		return strings.TrimSpace(card.Find(selector).First().Text())
+	}
+
+	raw := RawCard{
+		ViewCount:    text(selectors.ViewCount),
+		LikeCount:    text(selectors.LikeCount),
+		CommentCount: text(selectors.CommentCount),
+	}
+	raw.Href, _ = s.Find("a").Attr("href")
+	raw.ImgSrc, _ = img.Attr("src")
+	raw.ImgDataSrc, _ = img.Attr("data-src")
+	raw.ImgAlt, _ = img.Attr("alt")
+	raw.CaptionHTML, _ = card.Find(selectors.SearchCaption).First().Html()
+	raw.UserHref, _ = card.Find(selectors.SearchUserLink).Attr("href")
+	if parsed {
+		raw.Video = &video
+	}
+	return raw
+}
+
+// FetchRawCards loads pageUrl like FetchPageHTML and returns the raw values of every card
+// matched by any feed's item selector, so a broken selector or attribute shows up as
+// the field that came back empty
+func FetchRawCards(ctx context.Context, pageUrl string) ([]RawCard, error) {
+	htmlContent, err := FetchPageHTML(ctx, pageUrl)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(htmlContent))
+	if err != nil {
+		return nil, err
+	}
+
+	cardFeeds := []struct {
+		name string
+		feed feed
+	}{
+		{"search", feed{itemSelector: selectors.SearchItem, parseCard: parseSearchCard}},
+		{"hashtag", feed{itemSelector: selectors.HashtagItem, parseCard: parseGridCard}},
+		{"explore", feed{itemSelector: selectors.ExploreItem, parseCard: parseGridCard}},
+		{"user", feed{itemSelector: selectors.UserItem, parseCard: parseGridCard}},
+		{"related", feed{itemSelector: selectors.RelatedItem, parseCard: parseGridCard}},
+	}
+
+	cards := []RawCard{}
+	for _, cardFeed := range cardFeeds {
+		var raw []RawCard
+		cardFeed.feed.raw = &raw
+		domStrategy{f: cardFeed.feed, limit: math.MaxInt}.extractDoc(doc)
+
+		for _, card := range raw {
+			card.Feed = cardFeed.name
+			cards = append(cards, card)
+		}
+	}
+	return cards, nil
+}
@@ -0,0 +1,30 @@
+package services
+
+import "strings"
+
+// Filename used when nothing better can be derived
+const defaultDownloadName = "tiktok-video.mp4"
+
+// sanitizeFilename keeps letters, digits, dots, dashes and underscores, dropping path
+// separators and anything else that is unsafe in a Content-Disposition filename
+func sanitizeFilename(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			b.WriteRune(r)
+		}
+	}
+	return strings.Trim(b.String(), ".")
+}
+
+// DownloadFilename derives "<author>-<id>.mp4" from a TikTok video page URL,
+// falling back to tiktok-video.mp4
+func DownloadFilename(videoPageUrl string) string {
+	handle, videoID := parseVideoLink(videoPageUrl)
+	name := sanitizeFilename(strings.Trim(handle+"-"+videoID, "-"))
+	if name == "" {
+		return defaultDownloadName
+	}
+	return name + ".mp4"
+}
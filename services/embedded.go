@@ -0,0 +1,295 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// embeddedItem mirrors the parts of a video item in TikTok's embedded JSON. The schema
+// drifts between page versions, so the loosely typed fields are decoded by hand.
+type embeddedItem struct {
+	ID     string          `json:"id"`
+	Desc   string          `json:"desc"`
+	Author json.RawMessage `json:"author"` // A handle string in SIGI_STATE, an object elsewhere
+	Video  struct {
+		Cover        string `json:"cover"`
+		PlayAddr     string `json:"playAddr"`
+		DownloadAddr string `json:"downloadAddr"`
+	} `json:"video"`
+	ImagePost struct {
+		Images []struct {
+			ImageURL struct {
+				URLList []string `json:"urlList"`
+			} `json:"imageURL"`
+		} `json:"images"`
+	} `json:"imagePost"` // Only present on photo (slideshow) posts
+	Stats struct {
+		PlayCount    json.Number `json:"playCount"`
+		DiggCount    json.Number `json:"diggCount"`
+		CommentCount json.Number `json:"commentCount"`
+	} `json:"stats"`
+	Music struct {
+		ID         string `json:"id"`
+		Title      string `json:"title"`
+		AuthorName string `json:"authorName"`
+	} `json:"music"`
+}
+
+// rehydrationData mirrors TikTok's __UNIVERSAL_DATA_FOR_REHYDRATION__ script, which
+// keys one module per part of the page, such as webapp.video-detail, under one scope
+type rehydrationData struct {
+	DefaultScope map[string]json.RawMessage `json:"__DEFAULT_SCOPE__"`
+}
+
+// rehydrationModule mirrors the parts of a module that carry videos: the single item of
+// a video page, or the list of a search, hashtag or profile feed
+type rehydrationModule struct {
+	ItemInfo struct {
+		ItemStruct json.RawMessage `json:"itemStruct"`
+	} `json:"itemInfo"`
+	ItemList []json.RawMessage `json:"itemList"`
+}
+
+// sigiState mirrors the parts of the older SIGI_STATE script, which keys every video
+// on the page by its ID
+type sigiState struct {
+	ItemModule json.RawMessage `json:"ItemModule"`
+}
+
+// embeddedAuthor mirrors the author object of an embedded item
+type embeddedAuthor struct {
+	UniqueID    string `json:"uniqueId"`
+	Nickname    string `json:"nickname"`
+	AvatarThumb string `json:"avatarThumb"`
+}
+
+// author returns the author whichever shape the author field has. SIGI_STATE only
+// carries the handle, so the name and avatar stay empty there.
+func (item embeddedItem) author() embeddedAuthor {
+	var handle string
+	if json.Unmarshal(item.Author, &handle) == nil {
+		return embeddedAuthor{UniqueID: handle}
+	}
+
+	var author embeddedAuthor
+	json.Unmarshal(item.Author, &author)
+	if !isValidThumbnailURL(author.AvatarThumb) {
+		author.AvatarThumb = ""
+	}
+	return author
+}
+
+// toVideo converts an embedded item into a Video, false when it lacks an ID or author
+func (item embeddedItem) toVideo() (Video, bool) {
+	author := item.author()
+	handle := author.UniqueID
+	if item.ID == "" || handle == "" {
+		return Video{}, false
+	}
+
+	count := func(n json.Number) int {
+		value, _ := strconv.Atoi(n.String())
+		return value
+	}
+
+	cover := item.Video.Cover
+	if !isValidThumbnailURL(cover) {
+		cover = ""
+	}
+
+	return Video{
+		URL:          "https://www.tiktok.com/@" + handle + "/video/" + item.ID,
+		VideoID:      item.ID,
+		AuthorHandle: handle,
+		AuthorName:   author.Nickname,
+		AuthorAvatar: author.AvatarThumb,
+		Thumbnail:    cover,
+		HasThumbnail: cover != "",
+		Caption:      item.Desc,
+		User:         "https://www.tiktok.com/@" + handle,
+		Views:        count(item.Stats.PlayCount),
+		Likes:        count(item.Stats.DiggCount),
+		Comments:     count(item.Stats.CommentCount),
+		Hashtags:     parseHashtags(item.Desc),
+		Sound:        item.sound(),
+	}, true
+}
+
+// sound returns the item's music as a Sound, nil when it has none
+func (item embeddedItem) sound() *Sound {
+	if item.Music.Title == "" {
+		return nil
+	}
+
+	// Music pages live at /music/<title with dashes>-<id>
+	soundURL := ""
+	if item.Music.ID != "" {
+		slug := strings.Join(strings.Fields(item.Music.Title), "-")
+		soundURL = "https://www.tiktok.com/music/" + url.PathEscape(slug) + "-" + item.Music.ID
+	}
+	return &Sound{Title: item.Music.Title, Author: item.Music.AuthorName, URL: soundURL}
+}
+
+// embeddedItems collects the video items from whichever embedded JSON the page has,
+// in page order, skipping entries that do not parse
+func embeddedItems(doc *goquery.Document) []embeddedItem {
+	return append(universalItems(doc), sigiItems(doc)...)
+}
+
+// universalItems decodes the video items of the __UNIVERSAL_DATA_FOR_REHYDRATION__
+// script: the single item of a video page comes first, then the feed lists in list order
+func universalItems(doc *goquery.Document) []embeddedItem {
+	single, lists := decodeUniversal(doc)
+	return append(single, lists...)
+}
+
+// decodeUniversal decodes the __UNIVERSAL_DATA_FOR_REHYDRATION__ script into the page's
+// own item, if it is a post page, and the items of its feed lists. The module names
+// differ between page types and versions, so every module is read.
+func decodeUniversal(doc *goquery.Document) (single, lists []embeddedItem) {
+	script := doc.Find(`script#__UNIVERSAL_DATA_FOR_REHYDRATION__`).First().Text()
+	if script == "" {
+		return nil, nil
+	}
+
+	var data rehydrationData
+	if json.Unmarshal([]byte(script), &data) != nil {
+		return nil, nil
+	}
+
+	// Modules that do not match the expected shape are skipped rather than failing the
+	// page, in name order so the result does not depend on map iteration
+	names := make([]string, 0, len(data.DefaultScope))
+	modules := make(map[string]rehydrationModule, len(data.DefaultScope))
+	for name, raw := range data.DefaultScope {
+		var module rehydrationModule
+		if json.Unmarshal(raw, &module) == nil {
+			names = append(names, name)
+			modules[name] = module
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if raw := modules[name].ItemInfo.ItemStruct; raw != nil {
+			var item embeddedItem
+			if json.Unmarshal(raw, &item) == nil {
+				single = append(single, item)
+			}
+		}
+	}
+	for _, name := range names {
+		for _, raw := range modules[name].ItemList {
+			var item embeddedItem
+			if json.Unmarshal(raw, &item) == nil {
+				lists = append(lists, item)
+			}
+		}
+	}
+	return single, lists
+}
+
+// sigiItems decodes the video items of the SIGI_STATE script in page order
+func sigiItems(doc *goquery.Document) []embeddedItem {
+	script := doc.Find(`script#SIGI_STATE`).First().Text()
+	if script == "" {
+		return nil
+	}
+
+	var state sigiState
+	if json.Unmarshal([]byte(script), &state) != nil {
+		return nil
+	}
+	return decodeItemModule(state.ItemModule)
+}
+
+// decodeItemModule decodes the values of the ItemModule object in document order,
+// which a map would lose
+func decodeItemModule(raw json.RawMessage) []embeddedItem {
+	var items []embeddedItem
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return nil
+	}
+	for decoder.More() {
+		// Skip the key, the item carries its own ID
+		if _, err := decoder.Token(); err != nil {
+			return items
+		}
+
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return items
+		}
+		var item embeddedItem
+		if json.Unmarshal(value, &item) == nil {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// embeddedVideos converts the page's embedded items into Videos
+func embeddedVideos(doc *goquery.Document) []Video {
+	var videos []Video
+	for _, item := range embeddedItems(doc) {
+		if video, ok := item.toVideo(); ok {
+			videos = append(videos, video)
+		}
+	}
+	return videos
+}
+
+// postItem finds post postID among the page's embedded items, or takes the page's own
+// item when the ID is not known. Post pages list related videos too, and a dead link
+// can redirect to another post, so no other item will do.
+func postItem(doc *goquery.Document, postID string) (embeddedItem, bool) {
+	if postID == "" {
+		if single, _ := decodeUniversal(doc); len(single) > 0 {
+			return single[0], true
+		}
+		return embeddedItem{}, false
+	}
+
+	for _, item := range embeddedItems(doc) {
+		if item.ID == postID {
+			return item, true
+		}
+	}
+	return embeddedItem{}, false
+}
+
+// embeddedVideoURL extracts the playback URL of post postID from the page's embedded JSON
+func embeddedVideoURL(doc *goquery.Document, postID string) string {
+	item, ok := postItem(doc, postID)
+	if !ok {
+		return ""
+	}
+	if item.Video.PlayAddr != "" {
+		return item.Video.PlayAddr
+	}
+	return item.Video.DownloadAddr
+}
+
+// embeddedImageURLs extracts the slide URLs of photo post postID from the page's embedded JSON
+func embeddedImageURLs(doc *goquery.Document, postID string) []string {
+	item, ok := postItem(doc, postID)
+	if !ok {
+		return nil
+	}
+
+	var images []string
+	for _, image := range item.ImagePost.Images {
+		if len(image.ImageURL.URLList) > 0 {
+			images = append(images, image.ImageURL.URLList[0])
+		}
+	}
+	return images
+}
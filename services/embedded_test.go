@@ -0,0 +1,85 @@
+package services
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// fixtureDoc parses testdata/name
+func fixtureDoc(t *testing.T, name string) *goquery.Document {
+	t.Helper()
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(readFixture(t, name)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestUniversalItemsFeedList(t *testing.T) {
+	videos := embeddedVideos(fixtureDoc(t, "universal_feed.html"))
+
+	// The item with a numeric ID does not parse and is skipped
+	if got := videoIDs(videos); !slices.Equal(got, []string{"7300000000000000011", "7300000000000000013"}) {
+		t.Fatalf("got videos %v", got)
+	}
+
+	first := videos[0]
+	if first.AuthorHandle != "dana" || first.AuthorName != "Dana" || first.Views != 120000 || first.Likes != 5300 || first.Comments != 87 {
+		t.Errorf("first video parsed as %+v", first)
+	}
+	if first.Sound == nil || first.Sound.Title != "original sound" {
+		t.Errorf("first video sound = %+v", first.Sound)
+	}
+
+	// Counts given as strings parse too, and a placeholder cover is no thumbnail
+	second := videos[1]
+	if second.Views != 4500 || second.HasThumbnail || second.Thumbnail != "" {
+		t.Errorf("second video parsed as %+v", second)
+	}
+}
+
+func TestUniversalItemsVideoDetail(t *testing.T) {
+	doc := fixtureDoc(t, "universal_video.html")
+
+	videos := embeddedVideos(doc)
+	if len(videos) != 1 || videos[0].VideoID != "7300000000000000021" {
+		t.Fatalf("got videos %v, want the video of the page", videoIDs(videos))
+	}
+	want := &Sound{Title: "Run  Boy Run", Author: "Woodkid", URL: "https://www.tiktok.com/music/Run-Boy-Run-7200000000000000002"}
+	if got := videos[0].Sound; got == nil || *got != *want {
+		t.Errorf("sound = %+v, want %+v", got, want)
+	}
+	if got := embeddedVideoURL(doc, "7300000000000000021"); got != "https://v16-webapp.tiktokcdn.com/video/21.mp4" {
+		t.Errorf("embeddedVideoURL = %q", got)
+	}
+}
+
+func TestPostLookupsSkipRelatedVideos(t *testing.T) {
+	doc := fixtureDoc(t, "universal_photo.html")
+	const photoLink = "https://www.tiktok.com/@grace/photo/7300000000000000031"
+
+	// The photo post has no video, the related clip's does not count
+	if got := embeddedVideoURL(doc, "7300000000000000031"); got != "" {
+		t.Errorf("embeddedVideoURL of the photo post = %q, want none", got)
+	}
+	if got, _ := videoURLFromDoc(doc, photoLink, ""); got != "" {
+		t.Errorf("videoURLFromDoc of the photo post = %q, want none", got)
+	}
+	images := embeddedImageURLs(doc, "7300000000000000031")
+	if len(images) != 2 || images[0] != "https://p16-sign.tiktokcdn.com/obj/slide1.jpeg" {
+		t.Errorf("embeddedImageURLs = %v, want both slides", images)
+	}
+
+	// A link to a post the page does not show, as after a redirect, finds nothing
+	if got, _ := videoURLFromDoc(doc, "https://www.tiktok.com/@ivan/video/7300000000000000099", ""); got != "" {
+		t.Errorf("videoURLFromDoc of another post = %q, want none", got)
+	}
+
+	// The related clip is still found by its own ID
+	if got := embeddedVideoURL(doc, "7300000000000000032"); got != "https://v16-webapp.tiktokcdn.com/video/32.mp4" {
+		t.Errorf("embeddedVideoURL of the related clip = %q", got)
+	}
+}
@@ -0,0 +1,57 @@
+package services
+
+import "errors"
+
+// Sentinel errors returned by the scrapers and the proxy, so handlers can map
+// each failure to the right HTTP status with errors.Is
+var (
+	// ErrScrapeTimeout is returned when a scrape does not finish within ScrapeTimeout
+	ErrScrapeTimeout = errors.New("scrape timed out")
+
+	// ErrNavTimeout is returned when a page does not load within NavTimeout
+	ErrNavTimeout = errors.New("page navigation timed out")
+
+	// ErrProfileNotFound is returned when a user profile does not exist
+	ErrProfileNotFound = errors.New("profile does not exist")
+
+	// ErrProfilePrivate is returned when a user profile is private
+	ErrProfilePrivate = errors.New("profile is private")
+
+	// ErrEmptyQuery is returned when a search query is empty or only whitespace
+	ErrEmptyQuery = errors.New("search query must not be empty")
+
+	// ErrInvalidParameter is returned when an option has an unsupported value
+	ErrInvalidParameter = errors.New("invalid parameter")
+
+	// ErrVideoNotFound is returned when a video page or media URL has no playable video
+	ErrVideoNotFound = errors.New("video not found")
+
+	// ErrNoMoreResults is returned when a page starts past the last available video
+	ErrNoMoreResults = errors.New("no more results available")
+
+	// ErrInvalidURL is returned when a caller passes a malformed URL
+	ErrInvalidURL = errors.New("invalid URL")
+
+	// ErrBlocked is returned when TikTok or its CDN refuses to serve us
+	ErrBlocked = errors.New("blocked by TikTok")
+
+	// ErrCaptchaRequired is returned when TikTok serves a verification page instead of content
+	ErrCaptchaRequired = errors.New("TikTok requires captcha verification, retry later")
+
+	// ErrForbiddenTarget is returned when a proxy URL points at a non-public address
+	ErrForbiddenTarget = errors.New("target address is not allowed")
+
+	// ErrUnexpectedContent is returned when the upstream answers with something other than video
+	ErrUnexpectedContent = errors.New("upstream did not return video content")
+
+	// ErrSelectorNotFound is returned when a page never renders the element a scraper
+	// waits for, which usually means TikTok changed its markup
+	ErrSelectorNotFound = errors.New("expected page element not found")
+
+	// ErrResponseTooLarge is returned when a proxied body exceeds MaxProxyBytes
+	ErrResponseTooLarge = errors.New("upstream response is too large")
+
+	// ErrTabClosed is returned when the browser tab running a scrape was torn down under
+	// it, after the scrape was already retried on a fresh tab
+	ErrTabClosed = errors.New("browser tab closed while in use")
+)
@@ -0,0 +1,408 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/chromedp/chromedp"
+)
+
+// Number of videos returned per page unless the caller asks for another limit
+const itemsPerPage = 6
+
+// MaxItemsPerPage caps the per-page limit a caller may ask for
+const MaxItemsPerPage = 50
+
+// MaxScrolls caps how many times a feed is scrolled while collecting a page
+var MaxScrolls = 20
+
+// MaxStalledScrolls stops scrolling after this many consecutive scrolls add no new videos
+var MaxStalledScrolls = 2
+
+// ReportWarnings adds the cards that failed to parse to each result's Warnings
+var ReportWarnings = false
+
+// feed describes a scrollable list of video cards on a TikTok page
+type feed struct {
+	url          string                                   // Page to navigate to
+	listSelector string                                   // Container that must be visible before scraping
+	itemSelector string                                   // Selector matching each video card
+	parseCard    func(s *goquery.Selection) (Video, bool) // Converts a card into a Video, false to skip it
+
+	// Keep whatever was parsed when a later scroll fails, for dynamic feeds
+	toleratePartial bool
+
+	// Optional markers rendered instead of the list when the page has no content
+	unavailable []pageMarker
+
+	// A list that never renders means there are no videos rather than a markup change
+	listOptional bool
+
+	// Never fall back to the embedded JSON, for pages where it describes something else
+	// than the list, like the video itself on a video page
+	skipEmbedded bool
+
+	// Optional destination for the raw values of every card parsed, for debugging
+	raw *[]RawCard
+
+	// Optional destination for why each card that failed to parse was left out
+	warnings *[]string
+
+	// Optional callback receiving each video of the requested page as it is extracted
+	onVideo func(Video)
+
+	// Videos per page, itemsPerPage when zero
+	perPage int
+
+	// Optional index of the first video to return, taking precedence over the page
+	offset *int
+}
+
+// PageOptions picks the window of a feed to return
+type PageOptions struct {
+	Limit  int  // videos per page, 6 by default and at most MaxItemsPerPage
+	Offset *int // optional index of the first video, used instead of the page
+}
+
+// scrapeFeedWindow scrapes the window of f that page and opts select
+func scrapeFeedWindow(ctx context.Context, f feed, page int, opts PageOptions) (*SearchResult, error) {
+	if opts.Offset != nil && *opts.Offset < 0 {
+		return nil, fmt.Errorf("%w: offset must not be negative", ErrInvalidParameter)
+	}
+	f.perPage = min(opts.Limit, MaxItemsPerPage)
+	f.offset = opts.Offset
+	return scrapeFeed(ctx, f, page)
+}
+
+// pageSize returns the number of videos per page of f
+func (f feed) pageSize() int {
+	if f.perPage < 1 {
+		return itemsPerPage
+	}
+	return f.perPage
+}
+
+// pageStart returns the index of the first video to return for page
+func (f feed) pageStart(page int) int {
+	if f.offset != nil {
+		return *f.offset
+	}
+	return (page - 1) * f.pageSize()
+}
+
+// pageMarker maps an element TikTok renders in place of a list to the error it means
+type pageMarker struct {
+	selector string
+	err      error
+}
+
+// extractVideos parses up to limit unique videos of f from doc, keeping the order in
+// which each video first appears. The strategies are tried in order and the first that
+// finds any video wins, its name is returned along with the videos.
+func extractVideos(doc *goquery.Document, f feed, limit int) ([]Video, string) {
+	for _, strategy := range f.strategies(limit) {
+		if videos := strategy.extractDoc(doc); len(videos) > 0 {
+			return videos, strategy.Name()
+		}
+	}
+	return nil, ""
+}
+
+// cardLink returns the absolute video link of a card
+func cardLink(s *goquery.Selection) (string, bool) {
+	videoLink, exists := s.Find("a").Attr("href")
+	if !exists {
+		return "", false
+	}
+
+	if !strings.HasPrefix(videoLink, "http") {
+		videoLink = "https://www.tiktok.com" + videoLink
+	}
+	return videoLink, true
+}
+
+// scrapeFeed scrapes one page of f, fast-failing while the circuit breaker is open
+func scrapeFeed(ctx context.Context, f feed, page int) (*SearchResult, error) {
+	if err := scrapeBreaker.allow(); err != nil {
+		return nil, err
+	}
+
+	result, err := scrapeFeedPageOnFreshTab(ctx, f, page)
+	scrapeBreaker.record(err)
+	return result, err
+}
+
+// scrapeFeedPageOnFreshTab scrapes one page of f, starting over on another tab if its tab
+// is torn down. Streams are not retried since their videos were already sent.
+func scrapeFeedPageOnFreshTab(ctx context.Context, f feed, page int) (*SearchResult, error) {
+	if f.onVideo != nil {
+		return scrapeFeedPage(ctx, f, page)
+	}
+	return onFreshTab(ctx, func() (*SearchResult, error) {
+		return scrapeFeedPage(ctx, f, page)
+	})
+}
+
+// scrapeFeedPage scrapes one page of f using a tab borrowed from the browser pool
+func scrapeFeedPage(ctx context.Context, f feed, page int) (*SearchResult, error) {
+	var videos []Video
+	var strategy string
+
+	// Cards that fail to parse are left out, and only fail the scrape if none parsed
+	var warnings []string
+	f.warnings = &warnings
+
+	// Collect one extra item beyond the page to detect whether a next page exists
+	target := f.pageStart(page) + f.pageSize() + 1
+
+	// Borrow a tab from the browser pool
+	stop := timePhase(ctx, "acquire")
+	tab, err := browserPool.Acquire(ctx)
+	stop()
+	if err != nil {
+		return nil, err
+	}
+	defer browserPool.Release(tab)
+
+	// Bound the whole scrape so a missing selector or a client disconnect cannot hang the tab
+	runCtx, cancel := tab.scrapeContext(ctx)
+	defer cancel()
+
+	// Skip fonts, media and trackers, but let the lazily loaded thumbnails in
+	if err := tab.blockResources(runCtx, true); err != nil {
+		return nil, err
+	}
+
+	// Initialize the HTML content
+	var htmlContent string
+
+	// Index of the next video to hand to f.onVideo
+	emitted := 0
+
+	// Wait for either the list, an unavailable marker or a captcha, whichever renders
+	markers := append(append([]pageMarker{}, f.unavailable...), captchaMarkers...)
+	waitSelector := f.listSelector
+	for _, marker := range markers {
+		waitSelector += ", " + marker.selector
+	}
+
+	// Navigate once, retrying since TikTok sometimes never renders the list on the first
+	// try, all within NavTimeout
+	var selectorErr error
+	navCtx, cancelNav := navContext(runCtx)
+	err = withRetry(navCtx, func() error {
+		stop := timePhase(ctx, "nav")
+		err := tab.run(navCtx, chromedp.Navigate(f.url))
+		stop()
+		if err != nil {
+			return err
+		}
+
+		defer timePhase(ctx, "wait")()
+		err = tab.waitVisible(navCtx, waitSelector)
+		if errors.Is(err, ErrSelectorNotFound) {
+			selectorErr = err
+		}
+		return err
+	})
+	cancelNav()
+	if err == nil {
+		err = tab.run(runCtx, settle())
+	}
+
+	// A missing list explains running out of time better than the timeout itself
+	if (errors.Is(err, ErrScrapeTimeout) || errors.Is(err, ErrNavTimeout)) && selectorErr != nil {
+		err = selectorErr
+	}
+	if f.listOptional && errors.Is(err, ErrSelectorNotFound) {
+		return paginate(nil, page, f.pageStart(page), f.pageSize())
+	}
+	if err != nil {
+		log.Printf("Error while loading %s: %v", f.url, err)
+		return nil, err
+	}
+
+	// Scroll the same page to load more content until we have enough items, giving up
+	// when TikTok stops appending results
+	var progress scrollProgress
+	for progress.more(target) {
+		actions := []chromedp.Action{}
+		if progress.scrolls > 0 {
+			// Scrolling to the bottom makes TikTok append the next batch of results
+			actions = append(actions,
+				chromedp.Evaluate(`window.scrollTo(0, document.body.scrollHeight)`, nil),
+				settle(),
+			)
+		}
+		actions = append(actions, chromedp.OuterHTML("html", &htmlContent))
+
+		stop := timePhase(ctx, "scroll")
+		err := tab.run(runCtx, actions...)
+		stop()
+		if err != nil {
+			log.Printf("Error while scrolling: %v", err)
+			if f.toleratePartial && len(videos) > 0 {
+				break
+			}
+			return nil, err
+		}
+
+		// Parse the loaded HTML with goquery
+		stop = timePhase(ctx, "parse")
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(htmlContent))
+		if err != nil {
+			stop()
+			log.Printf("Failed to parse HTML: %v", err)
+			return nil, err
+		}
+
+		// Bail out when the page rendered an unavailable marker instead of the list
+		if doc.Find(f.listSelector).Length() == 0 {
+			for _, marker := range markers {
+				if doc.Find(marker.selector).Length() > 0 {
+					stop()
+					return nil, marker.err
+				}
+			}
+			if isCaptchaPage(doc) {
+				stop()
+				return nil, ErrCaptchaRequired
+			}
+		}
+
+		// The page keeps every loaded card, so each snapshot replaces the previous one
+		warnings = warnings[:0]
+		videos, strategy = extractVideos(doc, f, target)
+		stop()
+		emitted = emitPageVideos(f, videos, page, emitted)
+		progress.record(len(videos))
+	}
+
+	if len(videos) == 0 && len(warnings) > 0 {
+		return nil, fmt.Errorf("%w: none of the %d cards on %s parsed, first: %s", ErrUnexpectedContent, len(warnings), f.url, warnings[0])
+	}
+	if len(warnings) > 0 {
+		log.Printf("Left %d unparsable cards out of %s: %s", len(warnings), f.url, strings.Join(warnings, "; "))
+	}
+	if strategy != "" {
+		log.Printf("Extracted %d videos from %s with the %s strategy", len(videos), f.url, strategy)
+	}
+
+	result, err := paginate(videos, page, f.pageStart(page), f.pageSize())
+	if err == nil && ReportWarnings && len(warnings) > 0 {
+		result.Warnings = warnings
+	}
+	return result, err
+}
+
+// scrollProgress decides when to stop scrolling a list: once it holds enough items, after
+// MaxScrolls snapshots, or after MaxStalledScrolls scrolls in a row added nothing
+type scrollProgress struct {
+	scrolls int // Snapshots taken so far, the first one before any scroll
+	items   int // Items in the latest snapshot
+	stalled int // Consecutive scrolls that did not grow the list
+}
+
+// more reports whether to take another snapshot to reach target items
+func (p *scrollProgress) more(target int) bool {
+	return p.scrolls < MaxScrolls && p.items < target && p.stalled < MaxStalledScrolls
+}
+
+// record counts a snapshot holding items items
+func (p *scrollProgress) record(items int) {
+	// Count scrolls that did not grow the list, the end of results or a layout change
+	if p.scrolls > 0 && items <= p.items {
+		p.stalled++
+	} else {
+		p.stalled = 0
+	}
+	p.items = items
+	p.scrolls++
+}
+
+// emitPageVideos passes the videos of the requested page that have not been emitted yet
+// to f.onVideo and returns the index to resume from on the next snapshot
+func emitPageVideos(f feed, videos []Video, page, emitted int) int {
+	if f.onVideo == nil {
+		return emitted
+	}
+
+	start := f.pageStart(page)
+	end := min(start+f.pageSize(), len(videos))
+	for i := max(start, emitted); i < end; i++ {
+		f.onVideo(videos[i])
+		emitted = i + 1
+	}
+	return emitted
+}
+
+// paginate slices the window of perPage videos starting at start out of the accumulated videos
+func paginate(videos []Video, page, start, perPage int) (*SearchResult, error) {
+	// Calculate the end index of the window
+	end := start + perPage
+
+	// The list rendered but held nothing, a genuinely empty result
+	if len(videos) == 0 {
+		return &SearchResult{
+			Videos:       []Video{},
+			Page:         page,
+			Offset:       start,
+			ItemsPerPage: perPage,
+			Empty:        true,
+		}, nil
+	}
+
+	// Safely slice videos based on pagination
+	if start >= len(videos) {
+		return nil, fmt.Errorf("%w: page starts at video %d of %d", ErrNoMoreResults, start+1, len(videos))
+	}
+	if end > len(videos) {
+		end = len(videos)
+	}
+
+	// Return only the requested window of videos
+	return &SearchResult{
+		Videos:       videos[start:end],
+		Page:         page,
+		Offset:       start,
+		ItemsPerPage: perPage,
+		HasNextPage:  len(videos) > start+perPage,
+		TotalFetched: len(videos),
+	}, nil
+}
+
+// parseGridCard converts a card from a video grid (hashtag, profile and explore pages).
+// Grid cards only carry the link, thumbnail and view count, so the caption comes from
+// the thumbnail's alt text and the user from the video link.
+func parseGridCard(s *goquery.Selection) (Video, bool) {
+	videoLink, exists := cardLink(s)
+	if !exists {
+		return Video{}, false
+	}
+
+	// Lazy or broken images leave the thumbnail empty rather than losing the video
+	img := s.Find("img")
+	thumbnail, hasThumbnail := extractThumbnail(img)
+	caption, _ := img.Attr("alt")
+
+	// Video links look like https://www.tiktok.com/@user/video/<id>
+	user := ""
+	if at := strings.Index(videoLink, "/@"); at >= 0 {
+		handle := strings.SplitN(videoLink[at+1:], "/", 2)[0]
+		user = "https://www.tiktok.com/" + handle
+	}
+
+	return Video{
+		URL:          videoLink,
+		Thumbnail:    thumbnail,
+		HasThumbnail: hasThumbnail,
+		Caption:      caption,
+		User:         user,
+		Views:        extractCount(s, selectors.ViewCount),
+		Hashtags:     parseHashtags(caption),
+	}, true
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// numberedVideos returns n videos with IDs 1 to n
+func numberedVideos(n int) []Video {
+	videos := make([]Video, n)
+	for i := range videos {
+		videos[i] = Video{VideoID: strconv.Itoa(i + 1)}
+	}
+	return videos
+}
+
+func TestPaginatePagesAreDistinct(t *testing.T) {
+	f := feed{}
+	videos := numberedVideos(13)
+
+	seen := make(map[string]int)
+	for page := 1; page <= 3; page++ {
+		result, err := paginate(videos, page, f.pageStart(page), f.pageSize())
+		if err != nil {
+			t.Fatalf("page %d: %v", page, err)
+		}
+		for _, video := range result.Videos {
+			if previous, ok := seen[video.VideoID]; ok {
+				t.Fatalf("video %s on page %d was already on page %d", video.VideoID, page, previous)
+			}
+			seen[video.VideoID] = page
+		}
+
+		wantNext := page < 3
+		if result.HasNextPage != wantNext {
+			t.Errorf("page %d: HasNextPage = %v, want %v", page, result.HasNextPage, wantNext)
+		}
+	}
+	if len(seen) != len(videos) {
+		t.Fatalf("pages covered %d videos, want %d", len(seen), len(videos))
+	}
+}
+
+func TestPageStart(t *testing.T) {
+	offset := 4
+	tests := []struct {
+		f    feed
+		page int
+		want int
+	}{
+		{feed{}, 1, 0},
+		{feed{}, 2, itemsPerPage},
+		{feed{perPage: 10}, 3, 20},
+		{feed{perPage: 10, offset: &offset}, 3, 4},
+	}
+	for _, tt := range tests {
+		if got := tt.f.pageStart(tt.page); got != tt.want {
+			t.Errorf("pageStart(%d) with perPage %d = %d, want %d", tt.page, tt.f.perPage, got, tt.want)
+		}
+	}
+}
+
+func TestPaginatePastTheEnd(t *testing.T) {
+	f := feed{}
+	if _, err := paginate(numberedVideos(7), 3, f.pageStart(3), f.pageSize()); !errors.Is(err, ErrNoMoreResults) {
+		t.Fatalf("err = %v, want ErrNoMoreResults", err)
+	}
+}
+
+func TestPaginateEmptyList(t *testing.T) {
+	result, err := paginate(nil, 1, 0, itemsPerPage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Empty || result.Videos == nil || len(result.Videos) != 0 {
+		t.Fatalf("got %+v, want an empty, non-nil page flagged Empty", result)
+	}
+}
+
+// fastPageLoads shortens the waits of a scrape against a local page
+func fastPageLoads(t *testing.T) {
+	t.Helper()
+	fastRetries(t)
+	originalSettle, originalWait := SettleDelay, SelectorWaitTimeout
+	SettleDelay, SelectorWaitTimeout = 0, 500*time.Millisecond
+	t.Cleanup(func() { SettleDelay, SelectorWaitTimeout = originalSettle, originalWait })
+}
+
+func TestScrapeRenderedEmptyList(t *testing.T) {
+	usePool(t, 1)
+	fastPageLoads(t)
+
+	f := searchFeed()
+	f.url = serveFixture(t, "search_empty.html")
+	result, err := scrapeFeedPage(context.Background(), f, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Empty || len(result.Videos) != 0 {
+		t.Fatalf("got %+v, want an empty result", result)
+	}
+}
+
+func TestScrapeMissingList(t *testing.T) {
+	usePool(t, 1)
+	fastPageLoads(t)
+
+	f := searchFeed()
+	f.url = serveFixture(t, "search_broken.html")
+	if _, err := scrapeFeedPage(context.Background(), f, 1); !errors.Is(err, ErrSelectorNotFound) {
+		t.Fatalf("err = %v, want ErrSelectorNotFound", err)
+	}
+}
+
+func TestScrapeReportsBrokenCards(t *testing.T) {
+	usePool(t, 1)
+	fastPageLoads(t)
+	original := ReportWarnings
+	ReportWarnings = true
+	t.Cleanup(func() { ReportWarnings = original })
+
+	f := searchFeed()
+	f.url = serveFixture(t, "search_one_broken.html")
+	result, err := scrapeFeedPage(context.Background(), f, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Videos) != 2 || len(result.Warnings) != 1 {
+		t.Fatalf("%d videos and warnings %q, want 2 videos and 1 warning", len(result.Videos), result.Warnings)
+	}
+
+	// Only a page where no card parses fails the scrape
+	f.parseCard = func(*goquery.Selection) (Video, bool) { return Video{}, false }
+	if _, err := scrapeFeedPage(context.Background(), f, 1); !errors.Is(err, ErrUnexpectedContent) {
+		t.Fatalf("err = %v, want ErrUnexpectedContent", err)
+	}
+}
+
+// scrollUntilDone feeds snapshot sizes to a scrollProgress until it stops, returning how
+// many snapshots it took
+func scrollUntilDone(target int, snapshot func(scroll int) int) int {
+	var progress scrollProgress
+	for progress.more(target) {
+		progress.record(snapshot(progress.scrolls))
+	}
+	return progress.scrolls
+}
+
+func TestScrollStopsWhenFeedStopsGrowing(t *testing.T) {
+	// 6 videos per scroll until the results run out at 18
+	scrolls := scrollUntilDone(100, func(scroll int) int {
+		return min(6*(scroll+1), 18)
+	})
+
+	// 3 growing snapshots, then MaxStalledScrolls that add nothing
+	if want := 3 + MaxStalledScrolls; scrolls != want {
+		t.Fatalf("took %d snapshots, want %d", scrolls, want)
+	}
+}
+
+func TestScrollStopsAtMaxScrolls(t *testing.T) {
+	// A feed that grows by one video per scroll forever
+	scrolls := scrollUntilDone(1000, func(scroll int) int { return scroll + 1 })
+	if scrolls != MaxScrolls {
+		t.Fatalf("took %d snapshots, want MaxScrolls = %d", scrolls, MaxScrolls)
+	}
+}
+
+func TestScrollStopsAtTarget(t *testing.T) {
+	scrolls := scrollUntilDone(13, func(scroll int) int { return 6 * (scroll + 1) })
+	if scrolls != 3 {
+		t.Fatalf("took %d snapshots for 13 videos at 6 per scroll, want 3", scrolls)
+	}
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// TrendingHashtagsTTL controls how long the trending hashtags are served from memory
+var TrendingHashtagsTTL = 15 * time.Minute
+
+// Hashtag is a trending hashtag and how many posts use it
+type Hashtag struct {
+	Tag       string `json:"tag"`
+	PostCount int    `json:"postCount"`
+}
+
+// trendingHashtags caches the last scraped list, trends change slowly
+var trendingHashtags struct {
+	mu        sync.Mutex
+	tags      []Hashtag
+	expiresAt time.Time
+}
+
+// GetTrendingHashtags returns the hashtags listed on TikTok's discover page, in the
+// order TikTok ranks them. A page without a hashtag section yields an empty list.
+func GetTrendingHashtags(ctx context.Context) ([]Hashtag, error) {
+	trendingHashtags.mu.Lock()
+	if time.Now().Before(trendingHashtags.expiresAt) {
+		tags := trendingHashtags.tags
+		trendingHashtags.mu.Unlock()
+		cacheHits.Add(1)
+		return tags, nil
+	}
+	trendingHashtags.mu.Unlock()
+	cacheMisses.Add(1)
+
+	start := time.Now()
+	tags, err := scrapeTrendingHashtags(ctx)
+	observeScrape("trending_hashtags", start, err)
+	if err != nil {
+		return nil, err
+	}
+
+	trendingHashtags.mu.Lock()
+	trendingHashtags.tags = tags
+	trendingHashtags.expiresAt = time.Now().Add(TrendingHashtagsTTL)
+	trendingHashtags.mu.Unlock()
+	return tags, nil
+}
+
+// scrapeTrendingHashtags loads the discover page and reads its hashtag links
+func scrapeTrendingHashtags(ctx context.Context) ([]Hashtag, error) {
+	// Wait for the page itself rather than the section, which may legitimately be absent
+	htmlContent, err := loadPageHTML(ctx, "https://www.tiktok.com/discover", "body")
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(htmlContent))
+	if err != nil {
+		return nil, err
+	}
+	if isCaptchaPage(doc) {
+		return nil, ErrCaptchaRequired
+	}
+	return extractHashtags(doc), nil
+}
+
+// extractHashtags parses the unique hashtag links of doc in page order
+func extractHashtags(doc *goquery.Document) []Hashtag {
+	tags := []Hashtag{}
+	seen := make(map[string]struct{})
+
+	doc.Find(selectors.TrendingHashtag).Each(func(i int, s *goquery.Selection) {
+		href, _ := s.Attr("href")
+		tag := hashtagFromLink(href)
+		if tag == "" {
+			return
+		}
+		if _, dup := seen[tag]; dup {
+			return
+		}
+		seen[tag] = struct{}{}
+
+		tags = append(tags, Hashtag{
+			Tag:       tag,
+			PostCount: extractCount(s, selectors.TrendingHashtagCount),
+		})
+	})
+	return tags
+}
+
+// hashtagFromLink returns the tag of a /tag/<name> link, or "" for other links
+func hashtagFromLink(link string) string {
+	parsedURL, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+
+	rest, ok := strings.CutPrefix(parsedURL.Path, "/tag/")
+	if !ok {
+		return ""
+	}
+	tag, _, _ := strings.Cut(rest, "/")
+	return tag
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+// HealthCheckTimeout bounds how long the browser health check may take
+var HealthCheckTimeout = 5 * time.Second
+
+// StartupCheckTimeout bounds the first Chrome launch, which is slower than later checks
+var StartupCheckTimeout = 30 * time.Second
+
+// CheckBrowser verifies Chrome is reachable by loading about:blank in a short-lived tab
+func CheckBrowser(allocator *Allocator) error {
+	err := loadBlankPage(allocator.Context(), HealthCheckTimeout)
+	if err != nil {
+		allocator.ReportFailure(err)
+		return err
+	}
+	allocator.ReportSuccess()
+	return nil
+}
+
+// VerifyBrowserLaunch makes sure Chrome can be started at all, returning an error with
+// guidance on how to fix the installation when it cannot
+func VerifyBrowserLaunch(allocator *Allocator) error {
+	err := loadBlankPage(allocator.Context(), StartupCheckTimeout)
+	if errors.Is(err, exec.ErrNotFound) {
+		return fmt.Errorf("chrome executable not found, install Chrome or Chromium or set CHROME_PATH: %w", err)
+	}
+	if err != nil {
+		return fmt.Errorf("chrome could not be launched, check CHROME_PATH and the sandbox flags: %w", err)
+	}
+	return nil
+}
+
+// loadBlankPage loads about:blank in a short-lived tab within timeout
+func loadBlankPage(allocatorCtx context.Context, timeout time.Duration) error {
+	// Use a dedicated tab so the check does not wait on a busy pool
+	ctx, cancel := chromedp.NewContext(allocatorCtx)
+	defer cancel()
+
+	ctx, cancelTimeout := context.WithTimeout(ctx, timeout)
+	defer cancelTimeout()
+
+	return chromedp.Run(ctx, chromedp.Navigate("about:blank"))
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// maxPlaylistBytes caps the size of an HLS playlist read into memory for rewriting
+const maxPlaylistBytes = 1 << 20
+
+// HLSProxyPath is the route playlist entries are rewritten to point at
+var HLSProxyPath = "/proxy-video"
+
+// playlistURIAttr matches the URI attribute of tags such as EXT-X-KEY and EXT-X-MEDIA
+var playlistURIAttr = regexp.MustCompile(`URI="([^"]*)"`)
+
+// playlistMagic is the tag every m3u8 playlist starts with
+const playlistMagic = "#EXTM3U"
+
+// isHLSPlaylist reports whether resp carries an m3u8 playlist, going by its Content-Type.
+// CDNs that label playlists generically still serve them at a .m3u8 path, and those are
+// only taken for playlists when the body starts with #EXTM3U, so a video that merely sits
+// at such a path is never buffered and rewritten. The peeked bytes stay in resp.Body.
+func isHLSPlaylist(resp *http.Response) bool {
+	contentType := strings.ToLower(resp.Header.Get("Content-Type"))
+	for _, playlistType := range []string{"application/vnd.apple.mpegurl", "application/x-mpegurl", "audio/mpegurl", "audio/x-mpegurl"} {
+		if strings.HasPrefix(contentType, playlistType) {
+			return true
+		}
+	}
+	if !strings.HasSuffix(strings.ToLower(resp.Request.URL.Path), ".m3u8") {
+		return false
+	}
+
+	body := bufio.NewReader(resp.Body)
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{body, resp.Body}
+	magic, _ := body.Peek(len(playlistMagic))
+	return string(magic) == playlistMagic
+}
+
+// serveHLSPlaylist relays a master or media playlist with every segment, variant and key
+// URI rewritten to go back through the proxy, so each request carries the CDN's Referer
+func serveHLSPlaylist(w http.ResponseWriter, r *http.Request, resp *http.Response) error {
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxPlaylistBytes+1))
+	if err != nil {
+		return err
+	}
+	if len(body) > maxPlaylistBytes {
+		return fmt.Errorf("%w: playlist exceeds %d bytes", ErrResponseTooLarge, maxPlaylistBytes)
+	}
+
+	// Carry the caller's API key over to the rewritten URLs, players will not add it
+	apiKey := r.URL.Query().Get("api_key")
+	proxied := func(target string) string {
+		params := url.Values{}
+		params.Set("url", target)
+		if apiKey != "" {
+			params.Set("api_key", apiKey)
+		}
+		return HLSProxyPath + "?" + params.Encode()
+	}
+
+	playlist := rewritePlaylist(string(body), resp.Request.URL, proxied)
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	w.Header().Set("Content-Length", fmt.Sprint(len(playlist)))
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return nil
+	}
+	_, err = io.WriteString(w, playlist)
+	return err
+}
+
+// rewritePlaylist resolves every URI in an m3u8 playlist against base and replaces it
+// with proxied(uri). URI lines and URI="..." tag attributes are rewritten, which covers
+// variants and renditions in master playlists and segments, keys and init maps in media
+// playlists.
+func rewritePlaylist(playlist string, base *url.URL, proxied func(string) string) string {
+	resolve := func(ref string) string {
+		target, err := base.Parse(strings.TrimSpace(ref))
+		if err != nil {
+			return ref
+		}
+		return proxied(target.String())
+	}
+
+	var out strings.Builder
+	scanner := bufio.NewScanner(strings.NewReader(playlist))
+	scanner.Buffer(make([]byte, 64*1024), maxPlaylistBytes)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+		case strings.HasPrefix(trimmed, "#"):
+			line = playlistURIAttr.ReplaceAllStringFunc(line, func(attr string) string {
+				ref := playlistURIAttr.FindStringSubmatch(attr)[1]
+				return `URI="` + resolve(ref) + `"`
+			})
+		default:
+			line = resolve(trimmed)
+		}
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	return out.String()
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// markProxied stands in for the proxy URL so rewritten entries are easy to read
+func markProxied(target string) string {
+	return "proxy:" + target
+}
+
+func TestRewriteMasterPlaylist(t *testing.T) {
+	base, _ := url.Parse("https://v16-webapp.tiktokcdn.com/hls/master.m3u8")
+	got := rewritePlaylist(readFixture(t, "master.m3u8"), base, markProxied)
+
+	want := `#EXTM3U
+#EXT-X-VERSION:6
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",URI="proxy:https://v16-webapp.tiktokcdn.com/hls/audio/index.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=1280000,RESOLUTION=720x1280,AUDIO="aac"
+proxy:https://v16-webapp.tiktokcdn.com/hls/720p/index.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=640000,RESOLUTION=480x854,AUDIO="aac"
+proxy:https://v19.tiktokcdn.com/hls/480p/index.m3u8
+`
+	if got != want {
+		t.Fatalf("rewritten master playlist:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRewriteMediaPlaylist(t *testing.T) {
+	base, _ := url.Parse("https://v16-webapp.tiktokcdn.com/hls/720p/index.m3u8")
+	got := rewritePlaylist(readFixture(t, "media.m3u8"), base, markProxied)
+
+	want := `#EXTM3U
+#EXT-X-VERSION:6
+#EXT-X-TARGETDURATION:4
+#EXT-X-MAP:URI="proxy:https://v16-webapp.tiktokcdn.com/hls/720p/init.mp4"
+#EXT-X-KEY:METHOD=AES-128,URI="proxy:https://v16-webapp.tiktokcdn.com/keys/clip.key"
+#EXTINF:4.0,
+proxy:https://v16-webapp.tiktokcdn.com/hls/720p/seg0.ts
+#EXTINF:3.2,
+proxy:https://v16-webapp.tiktokcdn.com/hls/720p/seg1.ts?sig=abc
+#EXT-X-ENDLIST
+`
+	if got != want {
+		t.Fatalf("rewritten media playlist:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestStreamVideoRewritesPlaylist(t *testing.T) {
+	videoUrl := fakeCDN(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		w.Write([]byte(readFixture(t, "media.m3u8")))
+	})
+
+	recorder := httptest.NewRecorder()
+	if err := streamVideo(recorder, httptest.NewRequest("GET", "/proxy-video?api_key=k1", nil), videoUrl); err != nil {
+		t.Fatal(err)
+	}
+	if got := recorder.Header().Get("Content-Type"); got != "application/vnd.apple.mpegurl" {
+		t.Fatalf("Content-Type %q", got)
+	}
+
+	// Segments come back through the proxy with the caller's API key
+	segment := "/proxy-video?api_key=k1&url=" + url.QueryEscape("http://v16-webapp.tiktokcdn.com/video/tos/seg0.ts")
+	if !strings.Contains(recorder.Body.String(), "\n"+segment+"\n") {
+		t.Fatalf("playlist does not proxy seg0.ts as %s:\n%s", segment, recorder.Body.String())
+	}
+}
+
+// m3u8Response is a response for a .m3u8 URL with the given Content-Type and body
+func m3u8Response(contentType, body string) *http.Response {
+	req := httptest.NewRequest("GET", "https://v16-webapp.tiktokcdn.com/hls/index.m3u8", nil)
+	resp := &http.Response{Header: http.Header{}, Body: io.NopCloser(strings.NewReader(body)), Request: req}
+	resp.Header.Set("Content-Type", contentType)
+	return resp
+}
+
+func TestIsHLSPlaylist(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        bool
+	}{
+		{"playlist type", "application/vnd.apple.mpegurl", "#EXTM3U\n", true},
+		{"generic type with magic", "application/octet-stream", "#EXTM3U\n#EXT-X-VERSION:3\n", true},
+		{"generic type without magic", "application/octet-stream", "\x00\x00\x00\x18ftypmp42", false},
+		{"video type without magic", "video/mp4", "\x00\x00\x00\x18ftypmp42", false},
+		{"empty body", "application/octet-stream", "", false},
+	}
+	for _, tt := range tests {
+		resp := m3u8Response(tt.contentType, tt.body)
+		if got := isHLSPlaylist(resp); got != tt.want {
+			t.Errorf("%s: isHLSPlaylist = %v, want %v", tt.name, got, tt.want)
+		}
+
+		// Peeking must leave the whole body for whoever reads it next
+		body, err := io.ReadAll(resp.Body)
+		if err != nil || string(body) != tt.body {
+			t.Errorf("%s: body %q after the check, want %q", tt.name, body, tt.body)
+		}
+	}
+
+	// A generic response elsewhere is not a playlist, whatever it holds
+	resp := m3u8Response("application/octet-stream", "#EXTM3U\n")
+	resp.Request = httptest.NewRequest("GET", "https://v16-webapp.tiktokcdn.com/video/tos/clip.mp4", nil)
+	if isHLSPlaylist(resp) {
+		t.Fatal("an .mp4 URL was taken for a playlist")
+	}
+}
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// Humanize randomizes the browser viewport and jitters the settle delays, so scrapes
+// look less like a script that always uses the same window and timing
+var Humanize = false
+
+// Bounds of the randomized window size, around common desktop resolutions
+const (
+	minWindowWidth  = 1280
+	maxWindowWidth  = 1920
+	minWindowHeight = 720
+	maxWindowHeight = 1080
+)
+
+// JitterFraction is how far a jittered delay may stray from its base, e.g. 0.3 for ±30%
+var JitterFraction = 0.3
+
+// humanizeRand is the source of all randomness behind Humanize
+var (
+	humanizeMu   sync.Mutex
+	humanizeRand = rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+)
+
+// SeedHumanize makes the random window sizes and delays repeatable
+func SeedHumanize(seed uint64) {
+	humanizeMu.Lock()
+	defer humanizeMu.Unlock()
+	humanizeRand = rand.New(rand.NewPCG(seed, seed))
+}
+
+// RandomWindowSize returns a window size within the desktop bounds
+func RandomWindowSize() (width, height int) {
+	humanizeMu.Lock()
+	defer humanizeMu.Unlock()
+	width = minWindowWidth + humanizeRand.IntN(maxWindowWidth-minWindowWidth+1)
+	height = minWindowHeight + humanizeRand.IntN(maxWindowHeight-minWindowHeight+1)
+	return width, height
+}
+
+// jitter returns d moved randomly by up to JitterFraction when Humanize is on, else d
+func jitter(d time.Duration) time.Duration {
+	if !Humanize || d <= 0 || JitterFraction <= 0 {
+		return d
+	}
+
+	humanizeMu.Lock()
+	defer humanizeMu.Unlock()
+	offset := (humanizeRand.Float64()*2 - 1) * JitterFraction
+	return time.Duration(float64(d) * (1 + offset))
+}
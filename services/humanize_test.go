@@ -0,0 +1,63 @@
+package services
+
+import (
+	"math/rand/v2"
+	"testing"
+	"time"
+)
+
+// humanizeSequence draws a few window sizes and delays from the current seed
+func humanizeSequence() []int {
+	var values []int
+	for range 5 {
+		width, height := RandomWindowSize()
+		values = append(values, width, height, int(jitter(time.Second)))
+	}
+	return values
+}
+
+func TestSeedHumanizeIsRepeatable(t *testing.T) {
+	original := Humanize
+	Humanize = true
+	t.Cleanup(func() {
+		Humanize = original
+		SeedHumanize(rand.Uint64())
+	})
+
+	SeedHumanize(42)
+	first := humanizeSequence()
+	SeedHumanize(42)
+	second := humanizeSequence()
+
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("seed 42 gave %v then %v", first, second)
+		}
+	}
+}
+
+func TestHumanizeBounds(t *testing.T) {
+	original := Humanize
+	t.Cleanup(func() { Humanize = original })
+
+	for range 200 {
+		width, height := RandomWindowSize()
+		if width < minWindowWidth || width > maxWindowWidth || height < minWindowHeight || height > maxWindowHeight {
+			t.Fatalf("window %dx%d is outside the desktop bounds", width, height)
+		}
+	}
+
+	Humanize = false
+	if d := jitter(time.Second); d != time.Second {
+		t.Fatalf("jitter with Humanize off = %v, want 1s", d)
+	}
+
+	Humanize = true
+	low := time.Duration(float64(time.Second) * (1 - JitterFraction))
+	high := time.Duration(float64(time.Second) * (1 + JitterFraction))
+	for range 200 {
+		if d := jitter(time.Second); d < low || d > high {
+			t.Fatalf("jitter(1s) = %v, want between %v and %v", d, low, high)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// MaxRedirectHops caps how many redirects ResolveShortLink follows
+var MaxRedirectHops = 10
+
+// errRedirectLoop stops the HTTP client when a short link keeps redirecting
+var errRedirectLoop = errors.New("redirect loop")
+
+// isTikTokHost reports whether host is tiktok.com or one of its subdomains
+func isTikTokHost(host string) bool {
+	host = strings.ToLower(host)
+	return host == "tiktok.com" || strings.HasSuffix(host, ".tiktok.com")
+}
+
+// isTikTokPage reports whether u is an http or https URL on a TikTok host
+func isTikTokPage(u *url.URL) bool {
+	return (u.Scheme == "http" || u.Scheme == "https") && isTikTokHost(u.Hostname())
+}
+
+// ResolveShortLink follows the redirects of a shortened link such as
+// https://vt.tiktok.com/<code> and returns the canonical video page URL
+func ResolveShortLink(ctx context.Context, shortUrl string) (string, error) {
+	parsedURL, err := url.ParseRequestURI(shortUrl)
+	if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || !isTikTokHost(parsedURL.Hostname()) {
+		return "", fmt.Errorf("%w: %s", ErrInvalidURL, shortUrl)
+	}
+
+	// Share the transport so redirects go through the upstream proxy as well
+	client := &http.Client{
+		Transport: httpClient.Transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > MaxRedirectHops {
+				return errRedirectLoop
+			}
+			for _, previous := range via {
+				if previous.URL.String() == req.URL.String() {
+					return errRedirectLoop
+				}
+			}
+			return nil
+		},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, shortUrl, nil)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+	setBrowserHeaders(req)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		if errors.Is(err, errRedirectLoop) {
+			return "", fmt.Errorf("%w: %s does not resolve to a page", ErrInvalidURL, shortUrl)
+		}
+		return "", err
+	}
+	resp.Body.Close()
+
+	// The redirect chain must end on TikTok itself
+	finalURL := resp.Request.URL
+	if !isTikTokHost(finalURL.Hostname()) {
+		return "", fmt.Errorf("%w: %s redirects outside TikTok", ErrInvalidURL, shortUrl)
+	}
+
+	// Drop the tracking parameters TikTok appends to shared links
+	if handle, videoID := parseVideoLink(finalURL.String()); videoID != "" {
+		return "https://www.tiktok.com/@" + handle + "/video/" + videoID, nil
+	}
+	return finalURL.Scheme + "://" + finalURL.Host + finalURL.Path, nil
+}
+
+// parseVideoLink extracts the author handle and numeric video ID from links shaped
+// like https://www.tiktok.com/@handle/video/<id>, returning empty strings otherwise
+func parseVideoLink(link string) (handle, videoID string) {
+	return parsePostLink(link, "video")
+}
+
+// parsePostID extracts the numeric ID from video links and from photo post links shaped
+// like https://www.tiktok.com/@handle/photo/<id>, empty for anything else
+func parsePostID(link string) string {
+	if _, videoID := parseVideoLink(link); videoID != "" {
+		return videoID
+	}
+	_, photoID := parsePostLink(link, "photo")
+	return photoID
+}
+
+// parsePostLink extracts the handle and ID from links shaped like /@handle/<kind>/<id>
+func parsePostLink(link, kind string) (handle, postID string) {
+	parsedURL, err := url.Parse(link)
+	if err != nil {
+		return "", ""
+	}
+
+	parts := strings.Split(strings.Trim(parsedURL.Path, "/"), "/")
+	if len(parts) < 3 || len(parts[0]) < 2 || parts[0][0] != '@' || parts[1] != kind || parts[2] == "" {
+		return "", ""
+	}
+
+	// The ID must be purely numeric
+	for _, r := range parts[2] {
+		if r < '0' || r > '9' {
+			return "", ""
+		}
+	}
+	return parts[0][1:], parts[2]
+}
@@ -0,0 +1,43 @@
+package services
+
+import "testing"
+
+func TestParseVideoLink(t *testing.T) {
+	tests := []struct {
+		link, handle, videoID string
+	}{
+		{"https://www.tiktok.com/@scout2015/video/6718335390845095173", "scout2015", "6718335390845095173"},
+		{"https://www.tiktok.com/@scout2015/video/6718335390845095173?is_from_webapp=1&sender_device=pc", "scout2015", "6718335390845095173"},
+		{"https://m.tiktok.com/@user.name_1/video/7300000000000000001/", "user.name_1", "7300000000000000001"},
+		{"/@bob/video/7300000000000000002", "bob", "7300000000000000002"},
+		{"https://www.tiktok.com/@alice/photo/7300000000000000003", "", ""},
+		{"https://www.tiktok.com/@alice", "", ""},
+		{"https://www.tiktok.com/@alice/video/", "", ""},
+		{"https://www.tiktok.com/@alice/video/12ab", "", ""},
+		{"https://vt.tiktok.com/ZSabc123/", "", ""},
+		{"https://www.tiktok.com/music/original-sound-7300000000000000004", "", ""},
+		{"%zz", "", ""},
+	}
+	for _, tt := range tests {
+		handle, videoID := parseVideoLink(tt.link)
+		if handle != tt.handle || videoID != tt.videoID {
+			t.Errorf("parseVideoLink(%q) = %q, %q, want %q, %q", tt.link, handle, videoID, tt.handle, tt.videoID)
+		}
+	}
+}
+
+func TestParsePostID(t *testing.T) {
+	tests := []struct {
+		link, postID string
+	}{
+		{"https://www.tiktok.com/@scout2015/video/6718335390845095173", "6718335390845095173"},
+		{"https://www.tiktok.com/@alice/photo/7300000000000000003?is_from_webapp=1", "7300000000000000003"},
+		{"https://www.tiktok.com/@alice/photo/12ab", ""},
+		{"https://vt.tiktok.com/ZSabc123/", ""},
+	}
+	for _, tt := range tests {
+		if got := parsePostID(tt.link); got != tt.postID {
+			t.Errorf("parsePostID(%q) = %q, want %q", tt.link, got, tt.postID)
+		}
+	}
+}
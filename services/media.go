@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Media types reported by GetPostMedia
+const (
+	MediaTypeVideo  = "video"
+	MediaTypeImages = "images"
+)
+
+// PostMedia is the playable content of a post, either a video or the images of a slideshow
+type PostMedia struct {
+	MediaType string   `json:"mediaType"`
+	VideoURL  string   `json:"videoUrl,omitempty"`
+	Images    []string `json:"images,omitempty"`
+}
+
+// GetPostMedia loads a post and returns its video URL, or its image URLs for photo
+// (slideshow) posts, which have no video source
+func GetPostMedia(ctx context.Context, postUrl string) (*PostMedia, error) {
+	start := time.Now()
+	media, err := scrapePostMedia(ctx, postUrl)
+	observeScrape("media", start, err)
+	return media, err
+}
+
+// scrapePostMedia loads a post in a pooled tab and extracts its video or images
+func scrapePostMedia(ctx context.Context, postUrl string) (*PostMedia, error) {
+	if _, err := url.ParseRequestURI(postUrl); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidURL, postUrl)
+	}
+
+	htmlContent, err := loadPageHTML(ctx, postUrl, videoPageSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(htmlContent))
+	if err != nil {
+		log.Printf("Failed to parse HTML: %v", err)
+		return nil, err
+	}
+	return postMediaFromDoc(doc, postUrl)
+}
+
+// postMediaFromDoc finds the media of the post postUrl points at on its loaded page.
+// Images are checked first: a photo post has no video of its own, so any video on its
+// page belongs to something else.
+func postMediaFromDoc(doc *goquery.Document, postUrl string) (*PostMedia, error) {
+	if images := slideshowImages(doc, parsePostID(postUrl)); len(images) > 0 {
+		return &PostMedia{MediaType: MediaTypeImages, Images: images}, nil
+	}
+	if videoUrl, _ := videoURLFromDoc(doc, postUrl, ""); videoUrl != "" {
+		return &PostMedia{MediaType: MediaTypeVideo, VideoURL: videoUrl}, nil
+	}
+
+	if isCaptchaPage(doc) {
+		return nil, ErrCaptchaRequired
+	}
+	return nil, fmt.Errorf("%w: no video or images in page markup or embedded data", ErrVideoNotFound)
+}
+
+// slideshowImages returns the images of photo post postID, from the embedded JSON or the
+// rendered slides
+func slideshowImages(doc *goquery.Document, postID string) []string {
+	if images := embeddedImageURLs(doc, postID); len(images) > 0 {
+		return images
+	}
+
+	var images []string
+	seen := make(map[string]struct{})
+	doc.Find(`.swiper-slide img`).Each(func(i int, s *goquery.Selection) {
+		// The carousel repeats slides to loop, keep each image once
+		if src, ok := extractThumbnail(s); ok {
+			if _, dup := seen[src]; !dup {
+				seen[src] = struct{}{}
+				images = append(images, src)
+			}
+		}
+	})
+	return images
+}
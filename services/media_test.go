@@ -0,0 +1,37 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestPostMediaPhotoWithRelatedVideo(t *testing.T) {
+	doc := fixtureDoc(t, "universal_photo.html")
+
+	media, err := postMediaFromDoc(doc, "https://www.tiktok.com/@grace/photo/7300000000000000031")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"https://p16-sign.tiktokcdn.com/obj/slide1.jpeg", "https://p16-sign.tiktokcdn.com/obj/slide2.jpeg"}
+	if media.MediaType != MediaTypeImages || media.VideoURL != "" || !slices.Equal(media.Images, want) {
+		t.Fatalf("got %+v, want the photo post's slides", media)
+	}
+}
+
+func TestPostMediaVideo(t *testing.T) {
+	doc := fixtureDoc(t, "universal_video.html")
+
+	media, err := postMediaFromDoc(doc, "https://www.tiktok.com/@frank/video/7300000000000000021")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if media.MediaType != MediaTypeVideo || media.VideoURL != "https://v16-webapp.tiktokcdn.com/video/21.mp4" {
+		t.Fatalf("got %+v, want the video", media)
+	}
+
+	// A post the page does not show is not found, rather than answered with this video
+	if _, err := postMediaFromDoc(doc, "https://www.tiktok.com/@ivan/video/7300000000000000099"); !errors.Is(err, ErrVideoNotFound) {
+		t.Fatalf("other post: err = %v, want ErrVideoNotFound", err)
+	}
+}
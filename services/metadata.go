@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// GetVideosMetadata refreshes the details of several video pages concurrently, returning
+// a Video per page in the order given. Pages that fail are left out and reported through
+// a *BatchError keyed by URL.
+func GetVideosMetadata(ctx context.Context, pageUrls []string) ([]Video, error) {
+	found := make(map[string]Video)
+	var mu sync.Mutex
+
+	err := runBatch(ctx, pageUrls, func(ctx context.Context, pageUrl string) error {
+		video, err := getVideoPageDetails(ctx, pageUrl)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		found[pageUrl] = video
+		mu.Unlock()
+		return nil
+	})
+
+	// Keep the caller's order, listing repeated URLs once
+	videos := make([]Video, 0, len(found))
+	for _, pageUrl := range pageUrls {
+		if video, ok := found[pageUrl]; ok {
+			videos = append(videos, video)
+			delete(found, pageUrl)
+		}
+	}
+	return videos, err
+}
+
+// GetVideoDetails scrapes the caption, author, counts and sound of the video at
+// videoPageUrl, or returns ErrVideoNotFound when the page holds no video
+func GetVideoDetails(ctx context.Context, videoPageUrl string) (Video, error) {
+	return getVideoPageDetails(ctx, videoPageUrl)
+}
+
+// getVideoPageDetails scrapes one video page, fast-failing while the circuit breaker is open
+func getVideoPageDetails(ctx context.Context, pageUrl string) (Video, error) {
+	if _, err := url.ParseRequestURI(pageUrl); err != nil {
+		return Video{}, fmt.Errorf("%w: %s", ErrInvalidURL, pageUrl)
+	}
+
+	// Without an ID there is no telling the video apart from the others on the page
+	if _, videoID := parseVideoLink(pageUrl); videoID == "" {
+		return Video{}, fmt.Errorf("%w: %s is not a video link such as https://www.tiktok.com/@user/video/<id>", ErrInvalidURL, pageUrl)
+	}
+	if err := scrapeBreaker.allow(); err != nil {
+		return Video{}, err
+	}
+
+	start := time.Now()
+	video, err := scrapeVideoPage(ctx, pageUrl)
+	observeScrape("video_metadata", start, err)
+	scrapeBreaker.record(err)
+	return video, err
+}
+
+// scrapeVideoPage loads a video page in a pooled tab and builds its Video from the
+// embedded JSON, which carries the caption, counts and author of the video, or from the
+// page markup when the JSON is missing
+func scrapeVideoPage(ctx context.Context, pageUrl string) (Video, error) {
+	htmlContent, err := loadPageHTML(ctx, pageUrl, videoPageSelector)
+	if err != nil {
+		return Video{}, err
+	}
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(htmlContent))
+	if err != nil {
+		return Video{}, err
+	}
+	return videoFromDoc(doc, pageUrl)
+}
+
+// videoFromDoc finds the video pageUrl points at on its loaded page
+func videoFromDoc(doc *goquery.Document, pageUrl string) (Video, error) {
+	// SIGI_STATE can list related videos too, so only the one the URL points at will do.
+	// A page whose JSON lacks it shows something else, as when a dead link redirects.
+	_, videoID := parseVideoLink(pageUrl)
+	videos := embeddedVideos(doc)
+	for _, video := range videos {
+		if video.VideoID == videoID {
+			return video, nil
+		}
+	}
+	if len(videos) > 0 {
+		return Video{}, fmt.Errorf("%w: the page does not show video %s", ErrVideoNotFound, videoID)
+	}
+
+	if isCaptchaPage(doc) {
+		return Video{}, ErrCaptchaRequired
+	}
+	if video, ok := videoFromMarkup(doc, pageUrl); ok {
+		return video, nil
+	}
+	return Video{}, fmt.Errorf("%w: no video data on the page", ErrVideoNotFound)
+}
+
+// videoFromMarkup reads a video page's details from its markup, false when pageUrl has no
+// video ID or the page has neither a caption nor an author, as on a removed video
+func videoFromMarkup(doc *goquery.Document, pageUrl string) (Video, bool) {
+	linkHandle, videoID := parseVideoLink(pageUrl)
+	if videoID == "" {
+		return Video{}, false
+	}
+
+	caption := strings.TrimSpace(doc.Find(selectors.VideoCaption).First().Text())
+	handle := strings.TrimPrefix(strings.TrimSpace(doc.Find(selectors.VideoAuthor).First().Text()), "@")
+	if caption == "" && handle == "" {
+		return Video{}, false
+	}
+
+	if handle == "" {
+		handle = linkHandle
+	}
+	thumbnail, _ := doc.Find(`meta[property="og:image"]`).Attr("content")
+	if !isValidThumbnailURL(thumbnail) {
+		thumbnail = ""
+	}
+
+	return Video{
+		URL:          "https://www.tiktok.com/@" + handle + "/video/" + videoID,
+		VideoID:      videoID,
+		AuthorHandle: handle,
+		AuthorName:   strings.TrimSpace(doc.Find(selectors.VideoAuthorName).First().Text()),
+		Thumbnail:    thumbnail,
+		HasThumbnail: thumbnail != "",
+		Caption:      caption,
+		User:         "https://www.tiktok.com/@" + handle,
+		Likes:        extractCount(doc.Selection, selectors.LikeCount),
+		Comments:     extractCount(doc.Selection, selectors.CommentCount),
+		Hashtags:     parseHashtags(caption),
+		Sound:        extractSound(doc.Find(selectors.VideoSound).First().Parent()),
+	}, true
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestVideoFromDocPicksRequestedVideo(t *testing.T) {
+	doc := fixtureDoc(t, "universal_video.html")
+
+	video, err := videoFromDoc(doc, "https://www.tiktok.com/@frank/video/7300000000000000021")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if video.VideoID != "7300000000000000021" || video.Caption != "Morning run #running #fitness" {
+		t.Fatalf("got %+v", video)
+	}
+
+	// A page showing another video, as after a dead link redirects, is not the video
+	if _, err := videoFromDoc(doc, "https://www.tiktok.com/@frank/video/7300000000000000099"); !errors.Is(err, ErrVideoNotFound) {
+		t.Fatalf("err = %v, want ErrVideoNotFound", err)
+	}
+}
+
+func TestVideoFromMarkup(t *testing.T) {
+	doc := fixtureDoc(t, "video_markup.html")
+
+	video, err := videoFromDoc(doc, "https://www.tiktok.com/@heidi/video/7300000000000000041")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if video.VideoID != "7300000000000000041" || video.AuthorHandle != "heidi" || video.AuthorName != "Heidi" ||
+		video.URL != "https://www.tiktok.com/@heidi/video/7300000000000000041" || !video.HasThumbnail {
+		t.Fatalf("got %+v", video)
+	}
+
+	// Without an ID in the link the markup cannot say which video it is
+	if video, ok := videoFromMarkup(doc, "https://www.tiktok.com/@heidi"); ok {
+		t.Fatalf("built %+v from a link without an ID", video)
+	}
+}
+
+func TestGetVideoDetailsRejectsNonVideoLinks(t *testing.T) {
+	for _, link := range []string{"https://www.tiktok.com/@heidi", "https://www.tiktok.com/@heidi/video/", "not a url"} {
+		if _, err := GetVideoDetails(context.Background(), link); !errors.Is(err, ErrInvalidURL) {
+			t.Errorf("%q: err = %v, want ErrInvalidURL", link, err)
+		}
+	}
+}
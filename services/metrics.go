@@ -0,0 +1,99 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Prometheus metrics exposed on /metrics
+var (
+	searchesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "deimos_searches_total",
+		Help: "Total number of video searches.",
+	})
+	videoURLFetchesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "deimos_video_url_fetches_total",
+		Help: "Total number of direct video URL lookups.",
+	})
+	proxyRequestsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "deimos_proxy_requests_total",
+		Help: "Total number of proxied video requests.",
+	})
+	scrapeErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "deimos_scrape_errors_total",
+		Help: "Scrape errors by operation and error type.",
+	}, []string{"operation", "type"})
+	scrapeDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "deimos_scrape_duration_seconds",
+		Help:    "Duration of scrape operations.",
+		Buckets: []float64{0.5, 1, 2, 5, 10, 20, 30, 60},
+	}, []string{"operation"})
+	activeTabs = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "deimos_active_tabs",
+		Help: "Number of chromedp tabs currently open.",
+	})
+	allocatorRecoveries = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "deimos_allocator_recoveries_total",
+		Help: "Number of times the browser allocator was recreated after failing.",
+	})
+	blockedRequestsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "deimos_blocked_requests_total",
+		Help: "Browser requests blocked by resource type or domain while scraping.",
+	})
+	breakerState = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "deimos_circuit_breaker_state",
+		Help: "Scrape circuit breaker state: 0 closed, 1 open, 2 half-open.",
+	})
+)
+
+// errorType classifies an error into a low-cardinality metric label
+func errorType(err error) string {
+	switch {
+	case errors.Is(err, ErrNavTimeout):
+		return "nav_timeout"
+	case errors.Is(err, ErrScrapeTimeout), errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, ErrProfileNotFound):
+		return "profile_not_found"
+	case errors.Is(err, ErrProfilePrivate):
+		return "profile_private"
+	case errors.Is(err, ErrVideoNotFound):
+		return "video_not_found"
+	case errors.Is(err, ErrNoMoreResults):
+		return "no_more_results"
+	case errors.Is(err, ErrInvalidURL), errors.Is(err, ErrInvalidParameter):
+		return "invalid_input"
+	case errors.Is(err, ErrBlocked):
+		return "blocked"
+	case errors.Is(err, ErrCaptchaRequired):
+		return "captcha"
+	case errors.Is(err, ErrForbiddenTarget):
+		return "forbidden_target"
+	case errors.Is(err, ErrUnexpectedContent):
+		return "unexpected_content"
+	case errors.Is(err, ErrResponseTooLarge):
+		return "too_large"
+	case errors.Is(err, ErrSelectorNotFound):
+		return "selector_not_found"
+	case errors.Is(err, ErrTabClosed):
+		return "tab_closed"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	default:
+		return "other"
+	}
+}
+
+// observeScrape records the duration and outcome of an operation started at start
+func observeScrape(operation string, start time.Time, err error) {
+	elapsed := time.Since(start)
+	scrapeDuration.WithLabelValues(operation).Observe(elapsed.Seconds())
+	recordScrapeDuration(elapsed)
+	if err != nil {
+		scrapeErrorsTotal.WithLabelValues(operation, errorType(err)).Inc()
+	}
+}
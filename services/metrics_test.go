@@ -0,0 +1,52 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func TestMetricsExposed(t *testing.T) {
+	// Vectors only show up once they have a series
+	observeScrape("search", time.Now(), ErrBlocked)
+
+	recorder := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(recorder.Body)
+
+	for _, name := range []string{
+		"deimos_searches_total",
+		"deimos_video_url_fetches_total",
+		"deimos_proxy_requests_total",
+		`deimos_scrape_errors_total{operation="search",type="blocked"}`,
+		`deimos_scrape_duration_seconds_count{operation="search"}`,
+		"deimos_active_tabs",
+	} {
+		if !strings.Contains(string(body), name) {
+			t.Errorf("/metrics is missing %s", name)
+		}
+	}
+}
+
+func TestErrorType(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("loading: %w", ErrNavTimeout), "nav_timeout"},
+		{ErrScrapeTimeout, "timeout"},
+		{ErrCaptchaRequired, "captcha"},
+		{fmt.Errorf("%w: bad page", ErrInvalidParameter), "invalid_input"},
+		{io.EOF, "other"},
+	}
+	for _, tt := range tests {
+		if got := errorType(tt.err); got != tt.want {
+			t.Errorf("errorType(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// oembedEndpoint is TikTok's public oEmbed API
+const oembedEndpoint = "https://www.tiktok.com/oembed"
+
+// VideoMetadata is the lightweight description of a video used for link embeds
+type VideoMetadata struct {
+	Title     string `json:"title"`
+	Author    string `json:"author"`
+	AuthorURL string `json:"authorUrl"`
+	Thumbnail string `json:"thumbnail"`
+	URL       string `json:"url"`
+}
+
+// oembedResponse holds the fields we use from TikTok's oEmbed reply
+type oembedResponse struct {
+	Title        string `json:"title"`
+	AuthorName   string `json:"author_name"`
+	AuthorURL    string `json:"author_url"`
+	ThumbnailURL string `json:"thumbnail_url"`
+}
+
+// GetVideoMetadata returns the title, author and thumbnail of a video page. It asks
+// TikTok's oEmbed API first and only falls back to the browser when that fails.
+func GetVideoMetadata(ctx context.Context, videoPageUrl string) (*VideoMetadata, error) {
+	parsedURL, err := url.ParseRequestURI(videoPageUrl)
+	if err != nil || !isTikTokHost(parsedURL.Hostname()) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidURL, videoPageUrl)
+	}
+
+	metadata, err := fetchOEmbed(ctx, videoPageUrl)
+	if err != nil {
+		log.Printf("oEmbed failed for %s, scraping instead: %v", videoPageUrl, err)
+		metadata, err = scrapeMetadata(ctx, videoPageUrl)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Report the canonical URL without tracking parameters when the link is a video
+	metadata.URL = videoPageUrl
+	if handle, videoID := parseVideoLink(videoPageUrl); videoID != "" {
+		metadata.URL = "https://www.tiktok.com/@" + handle + "/video/" + videoID
+	}
+	return metadata, nil
+}
+
+// fetchOEmbed asks TikTok's oEmbed API about a video page
+func fetchOEmbed(ctx context.Context, videoPageUrl string) (*VideoMetadata, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, oembedEndpoint+"?url="+url.QueryEscape(videoPageUrl), nil)
+	if err != nil {
+		return nil, err
+	}
+	setBrowserHeaders(req)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusBadRequest:
+		return nil, fmt.Errorf("%w: oEmbed returned status code %d", ErrVideoNotFound, resp.StatusCode)
+	default:
+		return nil, fmt.Errorf("oEmbed returned status code %d", resp.StatusCode)
+	}
+
+	var body oembedResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decoding oEmbed response: %w", err)
+	}
+	return &VideoMetadata{
+		Title:     body.Title,
+		Author:    body.AuthorName,
+		AuthorURL: body.AuthorURL,
+		Thumbnail: body.ThumbnailURL,
+	}, nil
+}
+
+// scrapeMetadata reads the Open Graph tags of a video page loaded in the browser
+func scrapeMetadata(ctx context.Context, videoPageUrl string) (*VideoMetadata, error) {
+	htmlContent, err := loadPageHTML(ctx, videoPageUrl, videoPageSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(htmlContent))
+	if err != nil {
+		return nil, err
+	}
+	if isCaptchaPage(doc) {
+		return nil, ErrCaptchaRequired
+	}
+
+	meta := func(property string) string {
+		content, _ := doc.Find(`meta[property="` + property + `"]`).Attr("content")
+		return strings.TrimSpace(content)
+	}
+
+	metadata := &VideoMetadata{
+		Title:     meta("og:title"),
+		Thumbnail: meta("og:image"),
+	}
+	if handle, _ := parseVideoLink(videoPageUrl); handle != "" {
+		metadata.Author = handle
+		metadata.AuthorURL = "https://www.tiktok.com/@" + handle
+	}
+
+	if metadata.Title == "" && metadata.Thumbnail == "" {
+		return nil, fmt.Errorf("%w: no metadata in page markup", ErrVideoNotFound)
+	}
+	return metadata, nil
+}
@@ -0,0 +1,303 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/chromedp/cdproto/emulation"
+	"github.com/chromedp/chromedp"
+)
+
+// ScrapeTimeout bounds how long a single scrape may drive the browser
+var ScrapeTimeout = 30 * time.Second
+
+// NavTimeout bounds navigating to a page and waiting for its content, retries included,
+// so a page that will not load fails fast instead of using up ScrapeTimeout
+var NavTimeout = 15 * time.Second
+
+// navContext derives the context of the navigation phase of a scrape running in ctx,
+// which ends with ErrNavTimeout after NavTimeout
+func navContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeoutCause(ctx, NavTimeout, ErrNavTimeout)
+}
+
+// SettleDelay is how long to let lazy content render after the awaited element appears
+// or after a scroll. Set it to 0 to rely on the explicit waits alone.
+var SettleDelay = time.Second
+
+// settle pauses for SettleDelay, jittered when Humanize is on
+func settle() chromedp.Action {
+	return chromedp.Sleep(jitter(SettleDelay))
+}
+
+// browserPool is the pool used by the scraping functions
+var browserPool *BrowserPool
+
+// UseBrowserPool sets the pool the scraping functions borrow tabs from
+func UseBrowserPool(pool *BrowserPool) {
+	browserPool = pool
+}
+
+// pooledTab is a chromedp tab that can be reused across requests
+type pooledTab struct {
+	ctx       context.Context
+	cancel    context.CancelFunc
+	broken    bool
+	idleSince time.Time // when the tab was last released
+}
+
+// scrapeContext derives a context for running actions on the tab that expires after
+// ScrapeTimeout and is cancelled as soon as the caller's ctx is done. The cause of the
+// cancellation is kept so run can report why the scrape stopped.
+func (t *pooledTab) scrapeContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	callerCtx, cancelCaller := context.WithCancelCause(t.ctx)
+	runCtx, cancel := context.WithTimeoutCause(callerCtx, ScrapeTimeout, ErrScrapeTimeout)
+	stop := context.AfterFunc(ctx, func() {
+		cancelCaller(context.Cause(ctx))
+	})
+	return runCtx, func() {
+		stop()
+		cancel()
+		cancelCaller(nil)
+	}
+}
+
+// run executes the actions within ctx and marks the tab broken if they fail
+func (t *pooledTab) run(ctx context.Context, actions ...chromedp.Action) error {
+	err := chromedp.Run(ctx, actions...)
+	if err != nil {
+		t.broken = true
+		return t.failure(ctx, err)
+	}
+	return err
+}
+
+// failure explains why actions on the tab failed with err: the tab itself closing, or
+// ctx ending rather than chromedp's generic error
+func (t *pooledTab) failure(ctx context.Context, err error) error {
+	// The caller's cancellation only reaches the derived ctx, never the tab's own
+	if t.ctx.Err() != nil {
+		return fmt.Errorf("%w: %v", ErrTabClosed, err)
+	}
+	if cause := context.Cause(ctx); cause != nil {
+		return cause
+	}
+	return err
+}
+
+// SelectorWaitTimeout bounds how long a page may take to render the element a scrape
+// waits for before concluding it is not there
+var SelectorWaitTimeout = 10 * time.Second
+
+// waitVisible waits up to SelectorWaitTimeout for selector, returning ErrSelectorNotFound
+// when it never appears. Only other failures mark the tab broken, since a page that is
+// missing an element leaves the tab perfectly usable.
+func (t *pooledTab) waitVisible(ctx context.Context, selector string) error {
+	waitCtx, cancel := context.WithTimeout(ctx, SelectorWaitTimeout)
+	defer cancel()
+
+	err := chromedp.Run(waitCtx, chromedp.WaitVisible(selector, chromedp.ByQuery))
+	if err != nil && ctx.Err() == nil && errors.Is(waitCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w: nothing matched %s within %v", ErrSelectorNotFound, selector, SelectorWaitTimeout)
+	}
+	if err != nil {
+		t.broken = true
+		return t.failure(ctx, err)
+	}
+	return err
+}
+
+// BrowserPool caps the number of live Chrome tabs and reuses them between requests
+type BrowserPool struct {
+	allocators *allocatorSet
+	tabs       chan *pooledTab
+	size       int
+}
+
+// NewBrowserPool creates a pool of at most size tabs, opened on each of the given
+// allocators in turn
+func NewBrowserPool(allocators []*Allocator, size int) *BrowserPool {
+	if size < 1 {
+		size = 1
+	}
+
+	pool := &BrowserPool{
+		allocators: newAllocatorSet(allocators),
+		tabs:       make(chan *pooledTab, size),
+		size:       size,
+	}
+
+	// Fill the pool with empty slots, tabs are opened lazily on first use
+	for i := 0; i < size; i++ {
+		pool.tabs <- &pooledTab{}
+	}
+	return pool
+}
+
+// Acquire waits for a free tab, opening a new one if the slot is empty
+func (p *BrowserPool) Acquire(ctx context.Context) (*pooledTab, error) {
+	if p == nil {
+		return nil, errors.New("browser pool is not initialized")
+	}
+
+	select {
+	case tab := <-p.tabs:
+		if tab.ctx != nil && tab.ctx.Err() == nil {
+			return tab, nil
+		}
+
+		// An idle tab whose browser died, e.g. after the allocator was recreated
+		if tab.ctx != nil {
+			tab.cancel()
+			activeTabs.Dec()
+			tab = &pooledTab{}
+		}
+
+		// Open the tab with the same User-Agent and language as the HTTP client, and a
+		// viewport of its own when Humanize is on
+		var allocator *Allocator
+		tab.ctx, tab.cancel, allocator = p.allocators.newContext()
+		setup := []chromedp.Action{emulation.SetUserAgentOverride(UserAgent).WithAcceptLanguage(AcceptLanguage)}
+		if Humanize {
+			width, height := RandomWindowSize()
+			setup = append(setup, emulation.SetDeviceMetricsOverride(int64(width), int64(height), 1, false))
+		}
+		if err := chromedp.Run(tab.ctx, setup...); err != nil {
+			tab.cancel()
+			p.tabs <- &pooledTab{}
+
+			// Failing to start Chrome while the caller is still waiting points at the allocator
+			if ctx.Err() == nil {
+				allocator.ReportFailure(err)
+			}
+			return nil, err
+		}
+		allocator.ReportSuccess()
+		failBlockedRequests(tab.ctx)
+		activeTabs.Inc()
+		return tab, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Release returns a tab to the pool, discarding it if it crashed
+func (p *BrowserPool) Release(tab *pooledTab) {
+	if tab.broken || tab.ctx.Err() != nil {
+		// Close the crashed tab and leave an empty slot to be recreated
+		tab.cancel()
+		activeTabs.Dec()
+		tab = &pooledTab{}
+	}
+	tab.idleSince = time.Now()
+	p.tabs <- tab
+}
+
+// ReapIdleTabs closes tabs left idle for longer than idle until ctx is done, leaving
+// empty slots that reopen a fresh tab on next use. Chrome tabs grow in memory the longer
+// they live, so recycling them bounds the footprint of a long-running server.
+func (p *BrowserPool) ReapIdleTabs(ctx context.Context, idle time.Duration) {
+	if idle <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(max(idle/2, time.Second))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if reaped := p.reapIdle(idle); reaped > 0 {
+				log.Printf("Closed %d tab(s) idle for over %v", reaped, idle)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// reapIdle makes one pass over the free tabs, closing those idle for longer than idle,
+// and returns how many it closed. Borrowed tabs are left alone.
+func (p *BrowserPool) reapIdle(idle time.Duration) int {
+	reaped := 0
+	for range len(p.tabs) {
+		var tab *pooledTab
+		select {
+		case tab = <-p.tabs:
+		default:
+			return reaped // Every free tab was borrowed meanwhile
+		}
+
+		// Requeued tabs go to the back, so each pass sees every free tab once
+		if tab.ctx != nil && time.Since(tab.idleSince) > idle {
+			tab.cancel()
+			activeTabs.Dec()
+			tab = &pooledTab{}
+			reaped++
+		}
+		p.tabs <- tab
+	}
+	return reaped
+}
+
+// WarmUp opens up to tabs tabs and loads about:blank in each, so the first requests do
+// not pay for launching Chrome. It returns once every tab is ready or timeout elapses;
+// tabs still starting by then finish in the background and join the pool.
+func (p *BrowserPool) WarmUp(tabs int, timeout time.Duration) {
+	tabs = min(tabs, p.size)
+	if tabs < 1 {
+		return
+	}
+
+	// Hold every tab until all are open, otherwise the same slot would be reused
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		opened := make(chan *pooledTab, tabs)
+		for i := 0; i < tabs; i++ {
+			go func() {
+				start := time.Now()
+				tab, err := p.Acquire(context.Background())
+				if err != nil {
+					log.Printf("Warm-up tab %d failed: %v", i+1, err)
+					opened <- nil
+					return
+				}
+
+				runCtx, cancel := tab.scrapeContext(context.Background())
+				err = tab.run(runCtx, chromedp.Navigate("about:blank"))
+				cancel()
+				if err != nil {
+					log.Printf("Warm-up tab %d failed: %v", i+1, err)
+				} else {
+					log.Printf("Warm-up tab %d ready in %v", i+1, time.Since(start).Round(time.Millisecond))
+				}
+				opened <- tab
+			}()
+		}
+
+		held := make([]*pooledTab, 0, tabs)
+		for i := 0; i < tabs; i++ {
+			if tab := <-opened; tab != nil {
+				held = append(held, tab)
+			}
+		}
+		for _, tab := range held {
+			p.Release(tab)
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		log.Printf("Browser warm-up still running after %v, continuing startup", timeout)
+	}
+}
+
+// Utilization returns the pool size and how many tabs are currently borrowed
+func (p *BrowserPool) Utilization() (size, inUse int) {
+	return p.size, p.size - len(p.tabs)
+}
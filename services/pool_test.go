@@ -0,0 +1,317 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+// testAllocator starts a headless Chrome for the test, skipping it when none is installed
+func testAllocator(t testing.TB) *Allocator {
+	t.Helper()
+
+	opts := append(chromedp.DefaultExecAllocatorOptions[:], chromedp.NoSandbox)
+	if path := os.Getenv("CHROME_PATH"); path != "" {
+		opts = append(opts, chromedp.ExecPath(path))
+	}
+	allocator := NewAllocator(context.Background(), opts...)
+	t.Cleanup(allocator.Close)
+	if err := VerifyBrowserLaunch(allocator); err != nil {
+		t.Skipf("Chrome is not available: %v", err)
+	}
+	return allocator
+}
+
+// usePool points the scrapers at a pool of size tabs on a test browser
+func usePool(t testing.TB, size int) {
+	t.Helper()
+	pool := NewBrowserPool([]*Allocator{testAllocator(t)}, size)
+	original := browserPool
+	browserPool = pool
+	t.Cleanup(func() { browserPool = original })
+}
+
+func TestPoolCapsLiveTabs(t *testing.T) {
+	const size = 3
+	pool := NewBrowserPool([]*Allocator{testAllocator(t)}, size)
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		borrowed int
+		peak     int
+	)
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tab, err := pool.Acquire(context.Background())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			mu.Lock()
+			borrowed++
+			peak = max(peak, borrowed)
+			mu.Unlock()
+
+			runCtx, cancel := tab.scrapeContext(context.Background())
+			if err := tab.run(runCtx, chromedp.Navigate("about:blank")); err != nil {
+				t.Error(err)
+			}
+			cancel()
+
+			mu.Lock()
+			borrowed--
+			mu.Unlock()
+			pool.Release(tab)
+		}()
+	}
+	wg.Wait()
+
+	if peak > size {
+		t.Fatalf("%d tabs were borrowed at once, the pool holds %d", peak, size)
+	}
+	if _, inUse := pool.Utilization(); inUse != 0 {
+		t.Fatalf("%d tabs still borrowed after every request finished", inUse)
+	}
+}
+
+func TestReleaseDiscardsBrokenTab(t *testing.T) {
+	pool := NewBrowserPool(nil, 1)
+	<-pool.tabs
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pool.Release(&pooledTab{ctx: ctx, cancel: cancel, broken: true})
+
+	tab := <-pool.tabs
+	if tab.ctx != nil {
+		t.Fatal("broken tab went back to the pool")
+	}
+	if ctx.Err() == nil {
+		t.Fatal("broken tab was not closed")
+	}
+}
+
+// idleTab returns a live pooled tab released idle ago
+func idleTab(idle time.Duration) *pooledTab {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &pooledTab{ctx: ctx, cancel: cancel, idleSince: time.Now().Add(-idle)}
+}
+
+func TestReapIdleRecyclesOldTabs(t *testing.T) {
+	pool := NewBrowserPool(nil, 3)
+	for range 3 {
+		<-pool.tabs
+	}
+	stale, fresh := idleTab(time.Hour), idleTab(time.Second)
+	pool.tabs <- stale
+	pool.tabs <- fresh
+	pool.tabs <- &pooledTab{}
+
+	if reaped := pool.reapIdle(time.Minute); reaped != 1 {
+		t.Fatalf("reaped %d tabs, want 1", reaped)
+	}
+	if stale.ctx.Err() == nil {
+		t.Fatal("the stale tab was not closed")
+	}
+	if fresh.ctx.Err() != nil {
+		t.Fatal("a recently used tab was closed")
+	}
+
+	// The pool keeps its size, the stale tab's slot reopens a tab on next use
+	if len(pool.tabs) != 3 {
+		t.Fatalf("pool holds %d slots, want 3", len(pool.tabs))
+	}
+}
+
+func TestReapIdleTabsRunsUntilShutdown(t *testing.T) {
+	pool := NewBrowserPool(nil, 1)
+	<-pool.tabs
+	stale := idleTab(time.Hour)
+	pool.tabs <- stale
+
+	ctx, shutdown := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		pool.ReapIdleTabs(ctx, 10*time.Millisecond)
+		close(stopped)
+	}()
+
+	select {
+	case <-stale.ctx.Done():
+	case <-time.After(3 * time.Second):
+		t.Fatal("the reaper never recycled the idle tab")
+	}
+
+	shutdown()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("the reaper kept running after shutdown")
+	}
+}
+
+// setScrapeTimeout lowers ScrapeTimeout for the duration of the test
+func setScrapeTimeout(t *testing.T, timeout time.Duration) {
+	t.Helper()
+	original := ScrapeTimeout
+	ScrapeTimeout = timeout
+	t.Cleanup(func() { ScrapeTimeout = original })
+}
+
+func TestScrapeContextTimeout(t *testing.T) {
+	setScrapeTimeout(t, 20*time.Millisecond)
+
+	tab := &pooledTab{ctx: context.Background()}
+	runCtx, cancel := tab.scrapeContext(context.Background())
+	defer cancel()
+
+	<-runCtx.Done()
+	if err := tab.failure(runCtx, runCtx.Err()); !errors.Is(err, ErrScrapeTimeout) {
+		t.Fatalf("failure = %v, want ErrScrapeTimeout", err)
+	}
+}
+
+// setNavTimeout lowers NavTimeout for the duration of the test
+func setNavTimeout(t *testing.T, timeout time.Duration) {
+	t.Helper()
+	original := NavTimeout
+	NavTimeout = timeout
+	t.Cleanup(func() { NavTimeout = original })
+}
+
+func TestNavTimeoutFiresBeforeScrapeTimeout(t *testing.T) {
+	setScrapeTimeout(t, time.Minute)
+	setNavTimeout(t, 20*time.Millisecond)
+
+	tab := &pooledTab{ctx: context.Background()}
+	runCtx, cancel := tab.scrapeContext(context.Background())
+	defer cancel()
+	navCtx, cancelNav := navContext(runCtx)
+	defer cancelNav()
+
+	<-navCtx.Done()
+	if err := tab.failure(navCtx, navCtx.Err()); !errors.Is(err, ErrNavTimeout) {
+		t.Fatalf("failure = %v, want ErrNavTimeout", err)
+	}
+
+	// The rest of the scrape keeps its own budget
+	if runCtx.Err() != nil {
+		t.Fatal("the navigation timeout ended the whole scrape")
+	}
+}
+
+func TestScrapeTimeoutCutsNavigationShort(t *testing.T) {
+	setScrapeTimeout(t, 20*time.Millisecond)
+	setNavTimeout(t, time.Minute)
+
+	tab := &pooledTab{ctx: context.Background()}
+	runCtx, cancel := tab.scrapeContext(context.Background())
+	defer cancel()
+	navCtx, cancelNav := navContext(runCtx)
+	defer cancelNav()
+
+	<-navCtx.Done()
+	if err := tab.failure(navCtx, navCtx.Err()); !errors.Is(err, ErrScrapeTimeout) {
+		t.Fatalf("failure = %v, want ErrScrapeTimeout", err)
+	}
+}
+
+func TestNavTimeoutOnUnreachablePage(t *testing.T) {
+	pool := NewBrowserPool([]*Allocator{testAllocator(t)}, 1)
+	setScrapeTimeout(t, 10*time.Second)
+	setNavTimeout(t, 500*time.Millisecond)
+
+	tab, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Release(tab)
+
+	runCtx, cancel := tab.scrapeContext(context.Background())
+	defer cancel()
+	navCtx, cancelNav := navContext(runCtx)
+	defer cancelNav()
+
+	start := time.Now()
+	err = tab.run(navCtx, chromedp.Navigate("http://10.255.255.1/"))
+	if !errors.Is(err, ErrNavTimeout) {
+		t.Fatalf("run = %v, want ErrNavTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("navigation timeout fired after %v", elapsed)
+	}
+}
+
+func TestScrapeTimeoutOnUnreachablePage(t *testing.T) {
+	pool := NewBrowserPool([]*Allocator{testAllocator(t)}, 1)
+	setScrapeTimeout(t, 500*time.Millisecond)
+
+	tab, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Release(tab)
+
+	// A blackholed address never answers, so only the timeout can end the navigation
+	runCtx, cancel := tab.scrapeContext(context.Background())
+	defer cancel()
+	start := time.Now()
+	err = tab.run(runCtx, chromedp.Navigate("http://10.255.255.1/"))
+	if !errors.Is(err, ErrScrapeTimeout) {
+		t.Fatalf("run = %v, want ErrScrapeTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("timeout fired after %v", elapsed)
+	}
+}
+
+func TestScrapeContextFollowsCaller(t *testing.T) {
+	tab := &pooledTab{ctx: context.Background()}
+	callerCtx, cancelCaller := context.WithCancel(context.Background())
+	runCtx, cancel := tab.scrapeContext(callerCtx)
+	defer cancel()
+
+	// The client going away mid-scrape must stop the actions right away
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancelCaller()
+	}()
+	select {
+	case <-runCtx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("scrape context outlived its caller")
+	}
+
+	if err := tab.failure(runCtx, runCtx.Err()); !errors.Is(err, context.Canceled) {
+		t.Fatalf("failure = %v, want context.Canceled", err)
+	}
+	if tab.ctx.Err() != nil {
+		t.Fatal("cancelling the caller closed the pooled tab")
+	}
+}
+
+func TestSettleHonorsSettleDelay(t *testing.T) {
+	original := SettleDelay
+	t.Cleanup(func() { SettleDelay = original })
+
+	for _, delay := range []time.Duration{0, 50 * time.Millisecond} {
+		SettleDelay = delay
+		start := time.Now()
+		if err := settle().Do(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		elapsed := time.Since(start)
+		if elapsed < delay || elapsed > delay+40*time.Millisecond {
+			t.Errorf("SettleDelay %v: settled in %v", delay, elapsed)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// ScrapeAttempts is how many times a navigation is tried before giving up
+var ScrapeAttempts = 3
+
+// retryBackoff is the delay before the first retry, doubled after each attempt
+var retryBackoff = 500 * time.Millisecond
+
+// withRetry runs fn up to ScrapeAttempts times with exponential backoff,
+// giving up early once ctx is done
+func withRetry(ctx context.Context, fn func() error) error {
+	delay := retryBackoff
+
+	var err error
+	for attempt := 1; attempt <= ScrapeAttempts; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		if attempt == ScrapeAttempts || ctx.Err() != nil {
+			break
+		}
+
+		log.Printf("Scrape attempt %d failed: %v, retrying in %v", attempt, err, delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+		delay *= 2
+	}
+	return err
+}
+
+// TabAttempts is how many tabs a scrape may go through when the one it borrowed is
+// torn down under it, e.g. because Chrome crashed or the allocator was recreated
+var TabAttempts = 2
+
+// isRetryableChromeErr reports whether err means the tab was torn down mid-scrape, which
+// a fresh tab can fix. The caller cancelling or timing out never is, those end in
+// context.Canceled or a cause from its own context instead of ErrTabClosed.
+func isRetryableChromeErr(err error) bool {
+	return errors.Is(err, ErrTabClosed)
+}
+
+// onFreshTab runs scrape, running it again up to TabAttempts times in all while it fails
+// because its tab was torn down and ctx is still live
+func onFreshTab[T any](ctx context.Context, scrape func() (T, error)) (T, error) {
+	var result T
+	var err error
+	for attempt := 1; attempt <= TabAttempts; attempt++ {
+		result, err = scrape()
+		if !isRetryableChromeErr(err) || ctx.Err() != nil {
+			return result, err
+		}
+		log.Printf("Tab closed during scrape attempt %d: %v", attempt, err)
+	}
+	return result, err
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// fastRetries shrinks the retry backoff for the duration of the test
+func fastRetries(t *testing.T) {
+	t.Helper()
+	original := retryBackoff
+	retryBackoff = time.Millisecond
+	t.Cleanup(func() { retryBackoff = original })
+}
+
+func TestWithRetryRecovers(t *testing.T) {
+	fastRetries(t)
+
+	// A navigation that fails twice before the page finally loads
+	calls := 0
+	var videos []Video
+	err := withRetry(context.Background(), func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("net::ERR_CONNECTION_RESET")
+		}
+		videos = []Video{{VideoID: "1"}, {VideoID: "2"}}
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("withRetry = %v, want nil", err)
+	}
+	if calls != 3 {
+		t.Fatalf("ran %d times, want 3", calls)
+	}
+	if len(videos) != 2 {
+		t.Fatalf("got %d videos, want 2", len(videos))
+	}
+}
+
+func TestWithRetryGivesUp(t *testing.T) {
+	fastRetries(t)
+
+	calls := 0
+	failure := errors.New("net::ERR_CONNECTION_RESET")
+	err := withRetry(context.Background(), func() error {
+		calls++
+		return failure
+	})
+
+	if !errors.Is(err, failure) {
+		t.Fatalf("withRetry = %v, want the last failure", err)
+	}
+	if calls != ScrapeAttempts {
+		t.Fatalf("ran %d times, want %d", calls, ScrapeAttempts)
+	}
+}
+
+func TestWithRetryStopsWhenCancelled(t *testing.T) {
+	fastRetries(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	withRetry(ctx, func() error {
+		calls++
+		cancel()
+		return errors.New("net::ERR_CONNECTION_RESET")
+	})
+
+	if calls != 1 {
+		t.Fatalf("ran %d times after the caller went away, want 1", calls)
+	}
+}
+
+func TestTabFailureIsRetryable(t *testing.T) {
+	// The pool tearing the tab down under a live caller can be retried on another tab
+	tabCtx, closeTab := context.WithCancel(context.Background())
+	tab := &pooledTab{ctx: tabCtx}
+	runCtx, cancel := tab.scrapeContext(context.Background())
+	defer cancel()
+	closeTab()
+	if err := tab.failure(runCtx, context.Canceled); !isRetryableChromeErr(err) {
+		t.Fatalf("closed tab: %v is not retryable", err)
+	}
+
+	// The client going away is never retried, though chromedp reports the same error
+	tab = &pooledTab{ctx: context.Background()}
+	callerCtx, cancelCaller := context.WithCancel(context.Background())
+	runCtx, cancel = tab.scrapeContext(callerCtx)
+	defer cancel()
+	cancelCaller()
+	<-runCtx.Done()
+	if err := tab.failure(runCtx, context.Canceled); isRetryableChromeErr(err) {
+		t.Fatalf("client cancellation: %v is retryable", err)
+	}
+
+	for _, err := range []error{ErrScrapeTimeout, ErrNavTimeout, ErrSelectorNotFound, context.Canceled, nil} {
+		if isRetryableChromeErr(err) {
+			t.Errorf("%v is retryable", err)
+		}
+	}
+}
+
+func TestOnFreshTab(t *testing.T) {
+	closed := fmt.Errorf("%w: context canceled", ErrTabClosed)
+
+	// A torn down tab is retried until a fresh one succeeds
+	attempts := 0
+	result, err := onFreshTab(context.Background(), func() (string, error) {
+		attempts++
+		if attempts < 2 {
+			return "", closed
+		}
+		return "ok", nil
+	})
+	if err != nil || result != "ok" || attempts != 2 {
+		t.Fatalf("got %q, %v after %d attempts, want ok after 2", result, err, attempts)
+	}
+
+	// Retries stop at TabAttempts
+	attempts = 0
+	if _, err := onFreshTab(context.Background(), func() (string, error) {
+		attempts++
+		return "", closed
+	}); !errors.Is(err, ErrTabClosed) || attempts != TabAttempts {
+		t.Fatalf("err %v after %d attempts, want ErrTabClosed after %d", err, attempts, TabAttempts)
+	}
+
+	// Other failures and a cancelled caller are returned at once
+	attempts = 0
+	if _, err := onFreshTab(context.Background(), func() (string, error) {
+		attempts++
+		return "", ErrSelectorNotFound
+	}); !errors.Is(err, ErrSelectorNotFound) || attempts != 1 {
+		t.Fatalf("err %v after %d attempts, want ErrSelectorNotFound after 1", err, attempts)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	attempts = 0
+	if _, err := onFreshTab(ctx, func() (string, error) {
+		attempts++
+		return "", closed
+	}); attempts != 1 {
+		t.Fatalf("retried a cancelled caller %d times, err %v", attempts, err)
+	}
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// TikTok's sort_type search parameter for each supported sort order
+var sortTypes = map[string]int{
+	"relevance": 0,
+	"likes":     1,
+	"date":      3,
+}
+
+// TikTok's publish_time search parameter, the number of days to look back (0 for all time)
+var publishTimes = map[string]int{
+	"all":   0,
+	"day":   1,
+	"week":  7,
+	"month": 30,
+}
+
+// Languages TikTok's web app is translated into, accepted by the lang search parameter
+var searchLanguages = map[string]bool{
+	"ar": true, "bn": true, "cs": true, "de": true, "el": true, "en": true, "es": true,
+	"fi": true, "fil": true, "fr": true, "he": true, "hi": true, "hu": true, "id": true,
+	"it": true, "ja": true, "ko": true, "ms": true, "nl": true, "pl": true, "pt": true,
+	"ro": true, "ru": true, "sv": true, "th": true, "tr": true, "uk": true, "ur": true,
+	"vi": true, "zh": true,
+}
+
+// Regions TikTok serves content for, accepted by the region search parameter
+var searchRegions = map[string]bool{
+	"AE": true, "AR": true, "AT": true, "AU": true, "BE": true, "BR": true, "CA": true,
+	"CH": true, "CL": true, "CO": true, "CZ": true, "DE": true, "DK": true, "EG": true,
+	"ES": true, "FI": true, "FR": true, "GB": true, "GR": true, "HU": true, "ID": true,
+	"IE": true, "IL": true, "IT": true, "JP": true, "KR": true, "MA": true, "MX": true,
+	"MY": true, "NG": true, "NL": true, "NO": true, "NZ": true, "PE": true, "PH": true,
+	"PK": true, "PL": true, "PT": true, "RO": true, "SA": true, "SE": true, "SG": true,
+	"TH": true, "TR": true, "TW": true, "UA": true, "US": true, "VN": true, "ZA": true,
+}
+
+// SearchOptions holds the optional filters of a search
+type SearchOptions struct {
+	SortBy    string // relevance (default), likes or date
+	DateRange string // all (default), day, week or month
+	Limit     int    // videos per page, 6 by default and at most MaxItemsPerPage
+	Offset    *int   // optional index of the first video, used instead of the page
+	Lang      string // language of the results, the server's AcceptLanguage by default
+	Region    string // region of the results, the server's AcceptLanguage by default
+}
+
+// Validate fills in defaults, clamps the limit and rejects unknown sort or date range values
+func (o *SearchOptions) Validate() error {
+	if o.Limit < 1 {
+		o.Limit = itemsPerPage
+	}
+	o.Limit = min(o.Limit, MaxItemsPerPage)
+	if o.Offset != nil && *o.Offset < 0 {
+		return fmt.Errorf("%w: offset must not be negative", ErrInvalidParameter)
+	}
+	if o.SortBy == "" {
+		o.SortBy = "relevance"
+	}
+	if o.DateRange == "" {
+		o.DateRange = "all"
+	}
+	defaultLang, defaultRegion := defaultLocale()
+	if o.Lang == "" {
+		o.Lang = defaultLang
+	}
+	if o.Region == "" {
+		o.Region = defaultRegion
+	}
+	o.Lang = strings.ToLower(o.Lang)
+	o.Region = strings.ToUpper(o.Region)
+
+	if _, ok := sortTypes[o.SortBy]; !ok {
+		return fmt.Errorf("%w: unknown sortBy %q", ErrInvalidParameter, o.SortBy)
+	}
+	if _, ok := publishTimes[o.DateRange]; !ok {
+		return fmt.Errorf("%w: unknown dateRange %q", ErrInvalidParameter, o.DateRange)
+	}
+	if o.Lang != "" && !searchLanguages[o.Lang] {
+		return fmt.Errorf("%w: unknown lang %q", ErrInvalidParameter, o.Lang)
+	}
+	if o.Region != "" && !searchRegions[o.Region] {
+		return fmt.Errorf("%w: unknown region %q", ErrInvalidParameter, o.Region)
+	}
+	return nil
+}
+
+// ValidSortBy reports whether sortBy is a supported sort order
+func ValidSortBy(sortBy string) bool {
+	_, ok := sortTypes[sortBy]
+	return ok
+}
+
+// ValidDateRange reports whether dateRange is a supported date range
+func ValidDateRange(dateRange string) bool {
+	_, ok := publishTimes[dateRange]
+	return ok
+}
+
+// ValidLanguage reports whether lang is a supported language code, in any case
+func ValidLanguage(lang string) bool {
+	return searchLanguages[strings.ToLower(lang)]
+}
+
+// ValidRegion reports whether region is a supported region code, in any case
+func ValidRegion(region string) bool {
+	return searchRegions[strings.ToUpper(region)]
+}
+
+// defaultLocale derives the language and region from the first tag of AcceptLanguage,
+// e.g. en and US for "en-US,en;q=0.9". Parts that are not supported come back empty.
+func defaultLocale() (lang, region string) {
+	tag, _, _ := strings.Cut(AcceptLanguage, ",")
+	tag, _, _ = strings.Cut(tag, ";")
+	lang, region, _ = strings.Cut(strings.TrimSpace(tag), "-")
+	if !ValidLanguage(lang) {
+		lang = ""
+	}
+	if !ValidRegion(region) {
+		region = ""
+	}
+	return strings.ToLower(lang), strings.ToUpper(region)
+}
+
+// searchURL builds the TikTok search URL for query with the options applied
+func searchURL(query string, opts SearchOptions) string {
+	params := url.Values{}
+	params.Set("q", query)
+
+	// Only send the filters when they differ from TikTok's defaults
+	if sortType := sortTypes[opts.SortBy]; sortType != 0 {
+		params.Set("sort_type", strconv.Itoa(sortType))
+	}
+	if publishTime := publishTimes[opts.DateRange]; publishTime != 0 {
+		params.Set("publish_time", strconv.Itoa(publishTime))
+	}
+
+	// lang picks the language of the page and ranks results in it. region is the flag
+	// TikTok's web app sends with its own search requests to pick the regional catalogue
+	// instead of the one of the IP address.
+	if opts.Lang != "" {
+		params.Set("lang", opts.Lang)
+	}
+	if opts.Region != "" {
+		params.Set("region", opts.Region)
+	}
+	return "https://www.tiktok.com/search?" + params.Encode()
+}
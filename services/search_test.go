@@ -0,0 +1,43 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+)
+
+func TestSearchURLEscapesQuery(t *testing.T) {
+	for _, query := range []string{
+		"funny cats",
+		"salt & pepper",
+		"cats&sort_type=1",
+		"café ☕ 東京",
+		"#fyp 100%",
+	} {
+		parsed, err := url.Parse(searchURL(query, SearchOptions{SortBy: "relevance", DateRange: "all"}))
+		if err != nil {
+			t.Fatalf("%q: %v", query, err)
+		}
+		params := parsed.Query()
+		if got := params.Get("q"); got != query {
+			t.Errorf("q = %q, want %q", got, query)
+		}
+		if len(params) != 1 {
+			t.Errorf("%q: the query leaked into other parameters: %v", query, params)
+		}
+	}
+}
+
+func TestSearchRejectsBlankQuery(t *testing.T) {
+	stubSearch(t, func(ctx context.Context, query string, page int, opts SearchOptions, emit func(Video)) (*SearchResult, error) {
+		t.Fatal("blank query was scraped")
+		return nil, nil
+	})
+
+	for _, query := range []string{"", "   ", "\t\n"} {
+		if _, err := SearchTikTokVideos(context.Background(), query, 1, SearchOptions{}); !errors.Is(err, ErrEmptyQuery) {
+			t.Errorf("%q: err = %v, want ErrEmptyQuery", query, err)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// Selectors holds the CSS selectors used to find content on TikTok pages. TikTok renames
+// its data-e2e attributes from time to time, so every selector can be overridden from a
+// JSON file or the environment without a rebuild.
+type Selectors struct {
+	// Search results
+	SearchList     string `json:"searchList"`
+	SearchItem     string `json:"searchItem"`
+	SearchCaption  string `json:"searchCaption"`
+	SearchUserLink string `json:"searchUserLink"`
+	SearchUserName string `json:"searchUserName"`
+
+	// Hashtag, explore and profile grids
+	HashtagList  string `json:"hashtagList"`
+	HashtagItem  string `json:"hashtagItem"`
+	ExploreList  string `json:"exploreList"`
+	ExploreItem  string `json:"exploreItem"`
+	UserList     string `json:"userList"`
+	UserItem     string `json:"userItem"`
+	UserNotFound string `json:"userNotFound"`
+	UserPrivate  string `json:"userPrivate"`
+
+	// Details of a video page
+	VideoCaption    string `json:"videoCaption"`
+	VideoAuthor     string `json:"videoAuthor"`
+	VideoAuthorName string `json:"videoAuthorName"`
+	VideoSound      string `json:"videoSound"`
+
+	// Recommendations next to a video
+	RelatedList string `json:"relatedList"`
+	RelatedItem string `json:"relatedItem"`
+
+	// Hashtag links on the discover page and their post counts
+	TrendingHashtag      string `json:"trendingHashtag"`
+	TrendingHashtagCount string `json:"trendingHashtagCount"`
+
+	// Engagement counts on a card
+	ViewCount    string `json:"viewCount"`
+	LikeCount    string `json:"likeCount"`
+	CommentCount string `json:"commentCount"`
+
+	// Comment panel of a video page
+	CommentList   string `json:"commentList"`
+	CommentItem   string `json:"commentItem"`
+	CommentEmpty  string `json:"commentEmpty"`
+	CommentText   string `json:"commentText"`
+	CommentAuthor string `json:"commentAuthor"`
+	CommentLikes  string `json:"commentLikes"`
+	CommentTime   string `json:"commentTime"`
+}
+
+// DefaultSelectors matches TikTok's markup at the time of writing
+var DefaultSelectors = Selectors{
+	SearchList:     `div[data-e2e="search_top-item-list"]`,
+	SearchItem:     `div[data-e2e="search_top-item"]`,
+	SearchCaption:  `div[data-e2e="search-card-video-caption"]`,
+	SearchUserLink: `a[data-e2e="search-card-user-link"]`,
+	SearchUserName: `[data-e2e="search-card-user-nickname"], [data-e2e="search-card-user-unique-id"]`,
+
+	HashtagList:  `div[data-e2e="challenge-item-list"]`,
+	HashtagItem:  `div[data-e2e="challenge-item"]`,
+	ExploreList:  `div[data-e2e="explore-item-list"]`,
+	ExploreItem:  `div[data-e2e="explore-item"]`,
+	UserList:     `div[data-e2e="user-post-item-list"]`,
+	UserItem:     `div[data-e2e="user-post-item"]`,
+	UserNotFound: `[data-e2e="user-page-not-found"]`,
+	UserPrivate:  `[data-e2e="user-page-empty"]`,
+
+	VideoCaption:    `[data-e2e="browse-video-desc"]`,
+	VideoAuthor:     `[data-e2e="browse-username"]`,
+	VideoAuthorName: `[data-e2e="browser-nickname"]`,
+	VideoSound:      `[data-e2e="browse-music"] a`,
+
+	RelatedList: `div[data-e2e="related-video-list"]`,
+	RelatedItem: `div[data-e2e="related-video-item"]`,
+
+	TrendingHashtag:      `a[href*="/tag/"]`,
+	TrendingHashtagCount: `[data-e2e="challenge-vvcount"], [data-e2e="discover-tag-count"]`,
+
+	ViewCount:    `strong[data-e2e="video-views"]`,
+	LikeCount:    `strong[data-e2e="like-count"]`,
+	CommentCount: `strong[data-e2e="comment-count"]`,
+
+	CommentList:   `div[data-e2e="comment-list"]`,
+	CommentItem:   `div[data-e2e="comment-item"]`,
+	CommentEmpty:  `[data-e2e="comment-disabled"], [data-e2e="comment-empty"]`,
+	CommentText:   `[data-e2e="comment-level-1"]`,
+	CommentAuthor: `[data-e2e="comment-username-1"]`,
+	CommentLikes:  `[data-e2e="comment-like-count"]`,
+	CommentTime:   `[data-e2e="comment-time-1"]`,
+}
+
+// selectors is the set used by the scraping functions
+var selectors = DefaultSelectors
+
+// UseSelectors sets the selectors used by the scraping functions
+func UseSelectors(s Selectors) {
+	selectors = s
+}
+
+// LoadSelectors reads overrides from a JSON file keyed by the json names of Selectors.
+// Selectors missing from the file keep the value they have in base.
+func LoadSelectors(path string, base Selectors) (Selectors, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return base, err
+	}
+
+	// Reject misspelled names rather than silently keeping the default
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&base); err != nil {
+		return base, fmt.Errorf("%s: %w", path, err)
+	}
+	return base, nil
+}
+
+// ApplyEnv overrides each selector from the environment variable SELECTOR_ followed by
+// its json name in upper snake case, e.g. SELECTOR_SEARCH_LIST for searchList
+func (s *Selectors) ApplyEnv(lookup func(string) (string, bool)) {
+	v := reflect.ValueOf(s).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if value, ok := lookup(selectorEnvName(v.Type().Field(i))); ok {
+			v.Field(i).SetString(value)
+		}
+	}
+}
+
+// Validate reports every selector that is empty, since an empty selector would match
+// nothing and quietly break its endpoint
+func (s Selectors) Validate() error {
+	var missing []string
+	v := reflect.ValueOf(s)
+	for i := 0; i < v.NumField(); i++ {
+		if strings.TrimSpace(v.Field(i).String()) == "" {
+			missing = append(missing, v.Type().Field(i).Tag.Get("json"))
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("empty selectors: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// selectorEnvName converts a field's json name such as searchList to SELECTOR_SEARCH_LIST
+func selectorEnvName(field reflect.StructField) string {
+	var name strings.Builder
+	name.WriteString("SELECTOR_")
+	for _, r := range field.Tag.Get("json") {
+		if unicode.IsUpper(r) {
+			name.WriteByte('_')
+		}
+		name.WriteRune(unicode.ToUpper(r))
+	}
+	return name.String()
+}
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"slices"
+	"strconv"
+)
+
+// videoSortKeys extract the value each server-side sort orders by, 0 when it is missing
+var videoSortKeys = map[string]func(Video) int64{
+	"views":  func(v Video) int64 { return int64(v.Views) },
+	"likes":  func(v Video) int64 { return int64(v.Likes) },
+	"recent": videoTimestamp,
+}
+
+// ValidVideoSort reports whether by is an order SortVideos understands
+func ValidVideoSort(by string) bool {
+	_, ok := videoSortKeys[by]
+	return ok
+}
+
+// SortVideos returns a copy of videos ordered by views, likes or recent, highest first.
+// Videos missing the metric sort last and ties keep TikTok's order.
+func SortVideos(videos []Video, by string) []Video {
+	key, ok := videoSortKeys[by]
+	if !ok {
+		return videos
+	}
+
+	sorted := slices.Clone(videos)
+	slices.SortStableFunc(sorted, func(a, b Video) int {
+		ka, kb := key(a), key(b)
+		switch {
+		case ka == kb:
+			return 0
+		case ka == 0:
+			return 1
+		case kb == 0:
+			return -1
+		case ka > kb:
+			return -1
+		default:
+			return 1
+		}
+	})
+	return sorted
+}
+
+// videoTimestamp returns the Unix time a video was posted, which TikTok encodes in the
+// upper 32 bits of the video ID, or 0 when the ID is missing
+func videoTimestamp(v Video) int64 {
+	id, err := strconv.ParseUint(v.VideoID, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return int64(id >> 32)
+}
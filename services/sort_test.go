@@ -0,0 +1,37 @@
+package services
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+func TestSortVideos(t *testing.T) {
+	var videos []Video
+	if err := json.Unmarshal([]byte(readFixture(t, "sort_videos.json")), &videos); err != nil {
+		t.Fatal(err)
+	}
+	original := videoIDs(videos)
+
+	tests := []struct {
+		by   string
+		want []string
+	}{
+		// Ties keep TikTok's order and missing metrics come last
+		{"views", []string{"7400000000000000002", "7300000000000000001", "7100000000000000003", "", "not-a-number"}},
+		{"likes", []string{"7100000000000000003", "not-a-number", "7300000000000000001", "", "7400000000000000002"}},
+		// Videos without a numeric ID have no posting time
+		{"recent", []string{"7400000000000000002", "7300000000000000001", "7100000000000000003", "", "not-a-number"}},
+		{"unknown", original},
+	}
+	for _, tt := range tests {
+		if got := videoIDs(SortVideos(videos, tt.by)); !slices.Equal(got, tt.want) {
+			t.Errorf("sort=%s: %q, want %q", tt.by, got, tt.want)
+		}
+	}
+
+	// The cached result the videos come from must stay in TikTok's order
+	if got := videoIDs(videos); !slices.Equal(got, original) {
+		t.Fatalf("SortVideos reordered its input to %q", got)
+	}
+}
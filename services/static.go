@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// StaticFetch makes searches and video URL lookups first try the page's raw HTML over
+// plain HTTP, which often already embeds the JSON TikTok renders from, and only start the
+// browser when that yields nothing
+var StaticFetch = false
+
+// maxStaticPageBytes caps how much of a page fetchStatic reads
+const maxStaticPageBytes = 5 << 20
+
+// fetchStatic downloads pageUrl without rendering it and parses the HTML. Only TikTok
+// pages are fetched, since pageUrl comes straight from the request.
+func fetchStatic(ctx context.Context, pageUrl string) (*goquery.Document, error) {
+	defer timePhase(ctx, "static")()
+
+	if parsedURL, err := url.Parse(pageUrl); err != nil || !isTikTokPage(parsedURL) {
+		return nil, fmt.Errorf("%w: %s is not a TikTok page", ErrForbiddenTarget, pageUrl)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	setBrowserHeaders(req)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	resp, err := staticClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("static fetch of %s returned status code %d", pageUrl, resp.StatusCode)
+	}
+	return goquery.NewDocumentFromReader(io.LimitReader(resp.Body, maxStaticPageBytes))
+}
+
+// staticFeed returns page of f from the videos embedded in the raw HTML, false when
+// StaticFetch is off or the HTML does not hold the whole page
+func staticFeed(ctx context.Context, f feed, page int) (*SearchResult, bool) {
+	if !StaticFetch {
+		return nil, false
+	}
+
+	doc, err := fetchStatic(ctx, f.url)
+	if err != nil {
+		log.Printf("Static fetch failed, falling back to the browser: %v", err)
+		return nil, false
+	}
+
+	// Without scrolling only the first batch is available, so a page it does not fill
+	// needs the browser. One extra video tells whether a next page exists.
+	start := f.pageStart(page)
+	end := start + f.pageSize()
+	videos, strategy := extractVideos(doc, f, end+1)
+	if len(videos) < end {
+		return nil, false
+	}
+
+	log.Printf("Extracted %d videos from the static HTML of %s with the %s strategy", len(videos), f.url, strategy)
+	emitPageVideos(f, videos, page, 0)
+	result, err := paginate(videos, page, start, f.pageSize())
+	return result, err == nil
+}
+
+// staticVideoURL returns the playback URL embedded in the raw HTML of a video page,
+// empty when StaticFetch is off or the HTML has none
+func staticVideoURL(ctx context.Context, videoPageUrl, format string) (string, string) {
+	if !StaticFetch {
+		return "", ""
+	}
+
+	doc, err := fetchStatic(ctx, videoPageUrl)
+	if err != nil {
+		log.Printf("Static fetch failed, falling back to the browser: %v", err)
+		return "", ""
+	}
+	return videoURLFromDoc(doc, videoPageUrl, format)
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fakeTikTok serves fixture name as if it were TikTok: staticClient connects every
+// request to it
+func fakeTikTok(t *testing.T, name string) string {
+	t.Helper()
+
+	addr := strings.TrimPrefix(serveFixture(t, name), "http://")
+	original := staticClient
+	staticClient = &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, addr)
+			},
+		},
+		CheckRedirect: original.CheckRedirect,
+	}
+	t.Cleanup(func() { staticClient = original })
+	return "http://www.tiktok.com/search/video?q=cats"
+}
+
+// staticSearchFeed turns on StaticFetch and returns a search feed over the static fixture
+func staticSearchFeed(t *testing.T) feed {
+	original := StaticFetch
+	StaticFetch = true
+	t.Cleanup(func() { StaticFetch = original })
+
+	f := searchFeed()
+	f.url = fakeTikTok(t, "static_search.html")
+	return f
+}
+
+func TestStaticFeedServesFirstBatch(t *testing.T) {
+	f := staticSearchFeed(t)
+
+	result, ok := staticFeed(context.Background(), f, 1)
+	if !ok {
+		t.Fatal("the first page was not served from the static HTML")
+	}
+	want := []string{"7300000000000000001", "7300000000000000002", "7300000000000000003", "7300000000000000004", "7300000000000000005", "7300000000000000006"}
+	if got := videoIDs(result.Videos); !slices.Equal(got, want) {
+		t.Fatalf("videos %v, want %v", got, want)
+	}
+	if !result.HasNextPage {
+		t.Fatal("HasNextPage is false with two more videos in the HTML")
+	}
+
+	// A page the batch fills exactly has no known next page
+	f.perPage = 8
+	result, ok = staticFeed(context.Background(), f, 1)
+	if !ok || len(result.Videos) != 8 || result.HasNextPage {
+		t.Fatalf("8 per page: ok %v, result %+v, want all 8 videos and no next page", ok, result)
+	}
+}
+
+func TestStaticFeedFallsBackOnPartialPage(t *testing.T) {
+	f := staticSearchFeed(t)
+
+	// Page 2 only has 2 of its 6 videos in the HTML, the browser can scroll for the rest
+	if result, ok := staticFeed(context.Background(), f, 2); ok {
+		t.Fatalf("served a partial page from the static HTML: %v", videoIDs(result.Videos))
+	}
+
+	StaticFetch = false
+	if _, ok := staticFeed(context.Background(), f, 1); ok {
+		t.Fatal("served from the static HTML with StaticFetch off")
+	}
+}
+
+func TestFetchStaticOnlyFetchesTikTok(t *testing.T) {
+	dialed := stubResolver(t, map[string][]string{"www.tiktok.com": {"10.0.0.8"}})
+
+	for _, pageUrl := range []string{
+		"http://127.0.0.1:8080/admin",
+		"http://metadata.google.internal/computeMetadata/v1/",
+		"http://tiktok.com.example.org/",
+		"file:///etc/passwd",
+		"http://www.tiktok.com/@alice/video/7300000000000000001", // resolves to a private address
+	} {
+		if _, err := fetchStatic(context.Background(), pageUrl); !errors.Is(err, ErrForbiddenTarget) {
+			t.Errorf("%s: err = %v, want ErrForbiddenTarget", pageUrl, err)
+		}
+	}
+	if len(*dialed) != 0 {
+		t.Fatalf("dialed %v", *dialed)
+	}
+}
+
+func TestStaticRedirectStaysOnTikTok(t *testing.T) {
+	for _, tt := range []struct {
+		target  string
+		allowed bool
+	}{
+		{"https://www.tiktok.com/@alice/video/7300000000000000001", true},
+		{"https://m.tiktok.com/v/7300000000000000001.html", true},
+		{"http://169.254.169.254/latest/meta-data/", false},
+		{"https://evil.example.com/", false},
+	} {
+		req, _ := http.NewRequest("GET", tt.target, nil)
+		err := checkStaticRedirect(req, []*http.Request{{}})
+		if allowed := err == nil; allowed != tt.allowed {
+			t.Errorf("redirect to %s: err = %v, want allowed %v", tt.target, err, tt.allowed)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Counters behind the /stats snapshot, safe for concurrent use
+var (
+	cacheHits      atomic.Int64
+	cacheMisses    atomic.Int64
+	scrapesTotal   atomic.Int64
+	scrapeNanosSum atomic.Int64
+)
+
+// Stats is a human-friendly snapshot of the scraper internals
+type Stats struct {
+	CacheHits            int64   `json:"cacheHits"`
+	CacheMisses          int64   `json:"cacheMisses"`
+	Scrapes              int64   `json:"scrapes"`
+	AverageScrapeSeconds float64 `json:"averageScrapeSeconds"`
+	PoolSize             int     `json:"poolSize"`
+	PoolInUse            int     `json:"poolInUse"`
+}
+
+// recordScrapeDuration adds one scrape to the running average
+func recordScrapeDuration(d time.Duration) {
+	scrapesTotal.Add(1)
+	scrapeNanosSum.Add(int64(d))
+}
+
+// GetStats returns the current counters and browser pool utilization
+func GetStats() Stats {
+	stats := Stats{
+		CacheHits:   cacheHits.Load(),
+		CacheMisses: cacheMisses.Load(),
+		Scrapes:     scrapesTotal.Load(),
+	}
+	if stats.Scrapes > 0 {
+		stats.AverageScrapeSeconds = time.Duration(scrapeNanosSum.Load() / stats.Scrapes).Seconds()
+	}
+	if browserPool != nil {
+		stats.PoolSize, stats.PoolInUse = browserPool.Utilization()
+	}
+	return stats
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Strategy is one way of reading the videos off a rendered TikTok page. Each reads a
+// different surface, so a change to one of them only breaks its own strategy.
+type Strategy interface {
+	Name() string
+	Extract(html string) ([]Video, error)
+}
+
+// docStrategy is a Strategy that can also work on an already parsed page, which saves
+// parsing the HTML again after every scroll
+type docStrategy interface {
+	Strategy
+	extractDoc(doc *goquery.Document) []Video
+}
+
+// ExtractionStrategies lists the strategies feeds try in order, the first returning any
+// video wins. The default puts the most reliable first.
+var ExtractionStrategies = []string{"dom", "sigi", "universal"}
+
+// strategyRegistry builds each strategy by name for a feed and a video limit
+var strategyRegistry = map[string]func(f feed, limit int) docStrategy{
+	// The cards rendered in the list, matched with the configured selectors
+	"dom": func(f feed, limit int) docStrategy {
+		return domStrategy{f: f, limit: limit}
+	},
+	// The ItemModule of the SIGI_STATE script older page versions embed
+	"sigi": func(f feed, limit int) docStrategy {
+		return embeddedStrategy{name: "sigi", items: sigiItems, limit: limit}
+	},
+	// The __UNIVERSAL_DATA_FOR_REHYDRATION__ script newer page versions embed
+	"universal": func(f feed, limit int) docStrategy {
+		return embeddedStrategy{name: "universal", items: universalItems, limit: limit}
+	},
+}
+
+// ParseStrategies reads a comma-separated, ordered list of strategy names
+func ParseStrategies(raw string) ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if _, ok := strategyRegistry[name]; !ok {
+			return nil, fmt.Errorf("unknown extraction strategy %q, expected dom, sigi or universal", name)
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no extraction strategy given")
+	}
+	return names, nil
+}
+
+// strategies returns the strategies to try on f in order, collecting up to limit videos.
+// Feeds whose embedded JSON describes something else only read their cards.
+func (f feed) strategies(limit int) []docStrategy {
+	var strategies []docStrategy
+	for _, name := range ExtractionStrategies {
+		if f.skipEmbedded && name != "dom" {
+			continue
+		}
+		strategies = append(strategies, strategyRegistry[name](f, limit))
+	}
+	return strategies
+}
+
+// extractHTML parses html and runs the strategy on the document
+func extractHTML(strategy docStrategy, html string) ([]Video, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		return nil, err
+	}
+	return strategy.extractDoc(doc), nil
+}
+
+// videoCollector gathers up to limit unique videos in the order they first appear
+type videoCollector struct {
+	limit  int
+	seen   map[string]struct{}
+	videos []Video
+}
+
+func newVideoCollector(limit int) *videoCollector {
+	return &videoCollector{limit: limit, seen: make(map[string]struct{})}
+}
+
+// has reports whether a video with this URL was already collected
+func (c *videoCollector) has(videoURL string) bool {
+	_, dup := c.seen[videoURL]
+	return dup
+}
+
+// full reports whether limit videos were collected
+func (c *videoCollector) full() bool {
+	return len(c.videos) >= c.limit
+}
+
+// add appends video unless it was already seen, reporting whether to keep going
+func (c *videoCollector) add(video Video) bool {
+	// TikTok can render the same card twice while it recycles the list after a scroll
+	if c.has(video.URL) {
+		return true
+	}
+	c.seen[video.URL] = struct{}{}
+
+	// Photo posts and other link shapes leave the ID and handle empty
+	video.AuthorHandle, video.VideoID = parseVideoLink(video.URL)
+	c.videos = append(c.videos, video)
+	return !c.full()
+}
+
+// domStrategy parses the cards of a feed
+type domStrategy struct {
+	f     feed
+	limit int
+}
+
+func (s domStrategy) Name() string { return "dom" }
+
+func (s domStrategy) Extract(html string) ([]Video, error) { return extractHTML(s, html) }
+
+func (s domStrategy) extractDoc(doc *goquery.Document) []Video {
+	collected := newVideoCollector(s.limit)
+	doc.Find(s.f.itemSelector).EachWithBreak(func(i int, card *goquery.Selection) bool {
+		// Stop once we have collected enough items
+		if collected.full() {
+			return false
+		}
+
+		// Skip cards already collected before paying for a full parse
+		if link, ok := cardLink(card); ok && collected.has(link) {
+			return true
+		}
+
+		video, ok, warning := s.parseCard(i, card)
+		if s.f.raw != nil {
+			*s.f.raw = append(*s.f.raw, rawCard(card, video, ok))
+		}
+		if !ok {
+			if s.f.warnings != nil {
+				*s.f.warnings = append(*s.f.warnings, warning)
+			}
+			return true
+		}
+		return collected.add(video)
+	})
+	return collected.videos
+}
+
+// parseCard parses the i-th card, turning a panic over malformed markup into a warning
+// so the other cards still come back
+func (s domStrategy) parseCard(i int, card *goquery.Selection) (video Video, ok bool, warning string) {
+	defer func() {
+		if r := recover(); r != nil {
+			video, ok, warning = Video{}, false, fmt.Sprintf("card %d: parser panicked: %v", i+1, r)
+		}
+	}()
+
+	video, ok = s.f.parseCard(card)
+	if !ok {
+		link, _ := cardLink(card)
+		warning = fmt.Sprintf("card %d (%s): missing link or author", i+1, link)
+	}
+	return video, ok, warning
+}
+
+// embeddedStrategy converts the items of one of the page's embedded JSON scripts
+type embeddedStrategy struct {
+	name  string
+	items func(doc *goquery.Document) []embeddedItem
+	limit int
+}
+
+func (s embeddedStrategy) Name() string { return s.name }
+
+func (s embeddedStrategy) Extract(html string) ([]Video, error) { return extractHTML(s, html) }
+
+func (s embeddedStrategy) extractDoc(doc *goquery.Document) []Video {
+	collected := newVideoCollector(s.limit)
+	for _, item := range s.items(doc) {
+		if video, ok := item.toVideo(); ok && !collected.add(video) {
+			break
+		}
+	}
+	return collected.videos
+}
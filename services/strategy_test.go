@@ -0,0 +1,216 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// readFixture returns the contents of testdata/name
+func readFixture(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// serveFixture serves the testdata file name over HTTP and returns its URL
+func serveFixture(t *testing.T, name string) string {
+	html := readFixture(t, name)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(html))
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+// searchFeed is the feed of a search results page, without a URL to load
+func searchFeed() feed {
+	return feed{
+		listSelector: selectors.SearchList,
+		itemSelector: selectors.SearchItem,
+		parseCard:    parseSearchCard,
+	}
+}
+
+// videoIDs lists the IDs of videos in order
+func videoIDs(videos []Video) []string {
+	ids := make([]string, len(videos))
+	for i, video := range videos {
+		ids[i] = video.VideoID
+	}
+	return ids
+}
+
+func TestDOMStrategyDropsDuplicateCards(t *testing.T) {
+	videos, err := domStrategy{f: searchFeed(), limit: 10}.Extract(readFixture(t, "search_duplicates.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"7300000000000000001", "7300000000000000002", "7300000000000000003"}
+	if got := videoIDs(videos); !slices.Equal(got, want) {
+		t.Fatalf("got videos %v, want %v", got, want)
+	}
+}
+
+func TestDOMStrategyStopsAtLimit(t *testing.T) {
+	parsed := 0
+	f := searchFeed()
+	f.parseCard = func(card *goquery.Selection) (Video, bool) {
+		parsed++
+		return parseSearchCard(card)
+	}
+
+	videos, err := domStrategy{f: f, limit: 2}.Extract(readFixture(t, "search_duplicates.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(videos) != 2 || parsed != 2 {
+		t.Fatalf("collected %d videos parsing %d cards, want 2 and 2", len(videos), parsed)
+	}
+
+	// Repeated cards are skipped before they are parsed
+	parsed = 0
+	if _, err := (domStrategy{f: f, limit: 10}).Extract(readFixture(t, "search_duplicates.html")); err != nil {
+		t.Fatal(err)
+	}
+	if parsed != 3 {
+		t.Fatalf("parsed %d cards for 3 unique videos", parsed)
+	}
+}
+
+func TestEachStrategyReadsItsOwnSurface(t *testing.T) {
+	tests := []struct {
+		strategy string
+		fixture  string
+		want     []string
+	}{
+		{"dom", "search_duplicates.html", []string{"7300000000000000001", "7300000000000000002", "7300000000000000003"}},
+		{"sigi", "sigi_feed.html", []string{"7300000000000000032", "7300000000000000033"}},
+		{"universal", "universal_feed.html", []string{"7300000000000000011", "7300000000000000013"}},
+	}
+	for _, tt := range tests {
+		strategy := strategyRegistry[tt.strategy](searchFeed(), 10)
+		if strategy.Name() != tt.strategy {
+			t.Errorf("%s strategy is named %s", tt.strategy, strategy.Name())
+		}
+
+		for _, other := range tests {
+			videos, err := strategy.Extract(readFixture(t, other.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []string{}
+			if other.fixture == tt.fixture {
+				want = tt.want
+			}
+			if got := videoIDs(videos); !slices.Equal(got, want) {
+				t.Errorf("%s on %s: got %v, want %v", tt.strategy, other.fixture, got, want)
+			}
+		}
+	}
+}
+
+func TestSIGIStrategyKeepsPageOrder(t *testing.T) {
+	videos, err := strategyRegistry["sigi"](searchFeed(), 10).Extract(readFixture(t, "sigi_feed.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := videos[0]
+	if first.AuthorHandle != "frank" || first.URL != "https://www.tiktok.com/@frank/video/7300000000000000032" || first.Views != 9100 {
+		t.Fatalf("first video parsed as %+v", first)
+	}
+	if videos[1].Views != 880 {
+		t.Fatalf("string play count parsed as %d", videos[1].Views)
+	}
+}
+
+func TestExtractVideosFallsBack(t *testing.T) {
+	tests := []struct {
+		fixture  string
+		strategy string
+	}{
+		// Cards win when the list has them
+		{"search_duplicates.html", "dom"},
+		// An empty list falls back to the embedded JSON
+		{"sigi_feed.html", "sigi"},
+		{"universal_feed.html", "universal"},
+	}
+	for _, tt := range tests {
+		videos, strategy := extractVideos(fixtureDoc(t, tt.fixture), searchFeed(), 10)
+		if strategy != tt.strategy || len(videos) == 0 {
+			t.Errorf("%s: %d videos from %q, want some from %s", tt.fixture, len(videos), strategy, tt.strategy)
+		}
+	}
+
+	// Feeds that skip the embedded JSON only read their cards
+	f := searchFeed()
+	f.skipEmbedded = true
+	if videos, strategy := extractVideos(fixtureDoc(t, "sigi_feed.html"), f, 10); len(videos) != 0 {
+		t.Errorf("skipEmbedded feed read %d videos with %s", len(videos), strategy)
+	}
+}
+
+func TestParseStrategies(t *testing.T) {
+	names, err := ParseStrategies(" Universal, dom,,")
+	if err != nil || !slices.Equal(names, []string{"universal", "dom"}) {
+		t.Fatalf("got %v, %v", names, err)
+	}
+	for _, raw := range []string{"", " , ", "dom,xpath"} {
+		if _, err := ParseStrategies(raw); err == nil {
+			t.Errorf("%q was accepted", raw)
+		}
+	}
+}
+
+func TestDOMStrategyWarnsAboutBrokenCard(t *testing.T) {
+	var warnings []string
+	f := searchFeed()
+	f.warnings = &warnings
+
+	videos, err := domStrategy{f: f, limit: 10}.Extract(readFixture(t, "search_one_broken.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := videoIDs(videos); !slices.Equal(got, []string{"7300000000000000001", "7300000000000000003"}) {
+		t.Fatalf("got videos %v, want the two good cards", got)
+	}
+	want := []string{"card 2 (https://www.tiktok.com/@bob/video/7300000000000000002): missing link or author"}
+	if !slices.Equal(warnings, want) {
+		t.Fatalf("warnings %q, want %q", warnings, want)
+	}
+}
+
+func TestDOMStrategySurvivesPanickingCard(t *testing.T) {
+	var warnings []string
+	f := searchFeed()
+	f.warnings = &warnings
+	f.parseCard = func(card *goquery.Selection) (Video, bool) {
+		if link, _ := cardLink(card); strings.Contains(link, "@bob") {
+			var caption *string
+			_ = *caption
+		}
+		return parseSearchCard(card)
+	}
+
+	videos, err := domStrategy{f: f, limit: 10}.Extract(readFixture(t, "search_duplicates.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := videoIDs(videos); !slices.Equal(got, []string{"7300000000000000001", "7300000000000000003"}) {
+		t.Fatalf("got videos %v, want the cards that did not panic", got)
+	}
+	if len(warnings) == 0 || !strings.Contains(warnings[0], "card 2: parser panicked") {
+		t.Fatalf("warnings %q, want the panic of card 2", warnings)
+	}
+}
@@ -0,0 +1,188 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// MaxProxyBytes caps how many bytes a single proxied response may relay, 0 for no limit
+var MaxProxyBytes int64 = 200 << 20
+
+// AllowedProxyHosts lists the domain suffixes the video proxy may fetch from
+var AllowedProxyHosts = []string{"tiktokcdn.com", "tiktokcdn-us.com", "tiktokv.com", "muscdn.com"}
+
+// isAllowedProxyHost reports whether host is one of AllowedProxyHosts or a subdomain of one
+func isAllowedProxyHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, suffix := range AllowedProxyHosts {
+		suffix = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(suffix), "."))
+		if suffix == "" {
+			continue
+		}
+		if host == suffix || strings.HasSuffix(host, "."+suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// specialPurposeNets are non-routable ranges that net.IP has no helper for
+var specialPurposeNets = mustParseCIDRs(
+	"100.64.0.0/10", // carrier-grade NAT
+	"192.0.0.0/24",  // IETF protocol assignments
+	"198.18.0.0/15", // benchmarking
+	"2001:db8::/32", // documentation
+)
+
+// mustParseCIDRs parses a fixed list of networks, panicking on a typo
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets
+}
+
+// isPublicIP reports whether ip is routable on the internet, rejecting loopback,
+// private, link-local and other special-purpose ranges for both IPv4 and IPv6.
+// IPv4-mapped IPv6 addresses are checked as the IPv4 address they carry.
+func isPublicIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, ipNet := range specialPurposeNets {
+		if ipNet.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// lookupIPAddr resolves host names for the proxy, swapped out by tests
+var lookupIPAddr = net.DefaultResolver.LookupIPAddr
+
+// dialAddr opens the proxy's connections once the address is vetted, swapped out by tests
+var dialAddr = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+
+// resolvePublicIPs looks host up once and returns its addresses, failing if any of them
+// is not public so a mixed answer cannot slip a private address through
+func resolvePublicIPs(ctx context.Context, host string) ([]net.IP, error) {
+	// A literal IP needs no lookup but is held to the same rule
+	if ip := net.ParseIP(host); ip != nil {
+		if !isPublicIP(ip) {
+			return nil, fmt.Errorf("%w: %s is not a public address", ErrForbiddenTarget, host)
+		}
+		return []net.IP{ip}, nil
+	}
+
+	addrs, err := lookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("%w: %s has no addresses", ErrInvalidURL, host)
+	}
+
+	ips := make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		if !isPublicIP(addr.IP) {
+			return nil, fmt.Errorf("%w: %s resolves to %s", ErrForbiddenTarget, host, addr.IP)
+		}
+		ips = append(ips, addr.IP)
+	}
+	return ips, nil
+}
+
+// pinnedDialContext resolves the host of addr, checks every address is public and then
+// dials one of those exact addresses. Checking and connecting with the same lookup
+// means a DNS answer that changes in between (DNS rebinding) cannot reach a private
+// address, including on redirects.
+func pinnedDialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	ips, err := resolvePublicIPs(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	// Try each vetted address in turn, as the regular dialer would
+	var lastErr error
+	for _, ip := range ips {
+		conn, err := dialAddr(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// validateProxyTarget checks that videoUrl is an HTTP(S) URL on an allowed CDN host that only
+// resolves to public addresses, so the proxy cannot be used to reach other services
+func validateProxyTarget(ctx context.Context, videoUrl string) error {
+	parsedURL, err := url.Parse(videoUrl)
+	if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Hostname() == "" {
+		return fmt.Errorf("%w: %s", ErrInvalidURL, videoUrl)
+	}
+	if !isAllowedProxyHost(parsedURL.Hostname()) {
+		return fmt.Errorf("%w: %s is not an allowed video host", ErrForbiddenTarget, parsedURL.Hostname())
+	}
+
+	// Fail fast with a clear error; proxyClient repeats the check when it connects
+	_, err = resolvePublicIPs(ctx, parsedURL.Hostname())
+	return err
+}
+
+// checkProxySize rejects responses that announce a body larger than MaxProxyBytes
+func checkProxySize(resp *http.Response) error {
+	if MaxProxyBytes > 0 && resp.ContentLength > MaxProxyBytes {
+		return fmt.Errorf("%w: %d bytes exceeds the %d byte limit", ErrResponseTooLarge, resp.ContentLength, MaxProxyBytes)
+	}
+	return nil
+}
+
+// copyLimited copies src to dst, stopping with ErrResponseTooLarge once more than
+// MaxProxyBytes have been read. This catches bodies that lie about or omit their length.
+func copyLimited(dst io.Writer, src io.Reader) (int64, error) {
+	if MaxProxyBytes <= 0 {
+		return io.Copy(dst, src)
+	}
+
+	limited := &io.LimitedReader{R: src, N: MaxProxyBytes + 1}
+	written, err := io.Copy(dst, limited)
+	if err == nil && limited.N == 0 {
+		return written, fmt.Errorf("%w: exceeded the %d byte limit", ErrResponseTooLarge, MaxProxyBytes)
+	}
+	return written, err
+}
+
+// isVideoContentType reports whether an upstream Content-Type can carry video bytes
+func isVideoContentType(contentType string) bool {
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	return strings.HasPrefix(contentType, "video/") || strings.HasPrefix(contentType, "application/octet-stream")
+}
+
+// checkVideoContentType rejects responses that are not video, such as HTML error pages
+func checkVideoContentType(resp *http.Response) error {
+	if contentType := resp.Header.Get("Content-Type"); !isVideoContentType(contentType) {
+		return fmt.Errorf("%w: got %q", ErrUnexpectedContent, contentType)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProxyRejectsLocalTargets(t *testing.T) {
+	for _, host := range []string{"127.0.0.1", "::1", "10.0.0.8", "169.254.169.254", "::ffff:127.0.0.1"} {
+		if _, err := resolvePublicIPs(context.Background(), host); !errors.Is(err, ErrForbiddenTarget) {
+			t.Errorf("%s: err = %v, want ErrForbiddenTarget", host, err)
+		}
+	}
+	if err := validateProxyTarget(context.Background(), "http://localhost:8080/admin"); !errors.Is(err, ErrForbiddenTarget) {
+		t.Errorf("localhost URL: err = %v, want ErrForbiddenTarget", err)
+	}
+}
+
+// stubResolver answers lookups from answers and records every address dialed
+func stubResolver(t *testing.T, answers map[string][]string) *[]string {
+	t.Helper()
+
+	var dialed []string
+	originalLookup, originalDial := lookupIPAddr, dialAddr
+	lookupIPAddr = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		var addrs []net.IPAddr
+		for _, ip := range answers[host] {
+			addrs = append(addrs, net.IPAddr{IP: net.ParseIP(ip)})
+		}
+		return addrs, nil
+	}
+	dialAddr = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed = append(dialed, addr)
+		client, server := net.Pipe()
+		server.Close()
+		return client, nil
+	}
+	t.Cleanup(func() { lookupIPAddr, dialAddr = originalLookup, originalDial })
+	return &dialed
+}
+
+func TestPinnedDialRejectsPrivateAnswers(t *testing.T) {
+	dialed := stubResolver(t, map[string][]string{
+		"rebind.tiktokcdn.com": {"10.0.0.8"},
+		"mixed.tiktokcdn.com":  {"93.184.216.34", "127.0.0.1"},
+		"v6.tiktokcdn.com":     {"fd00::1"},
+	})
+
+	for _, host := range []string{"rebind.tiktokcdn.com", "mixed.tiktokcdn.com", "v6.tiktokcdn.com"} {
+		if _, err := pinnedDialContext(context.Background(), "tcp", net.JoinHostPort(host, "443")); !errors.Is(err, ErrForbiddenTarget) {
+			t.Errorf("%s: err = %v, want ErrForbiddenTarget", host, err)
+		}
+	}
+	if len(*dialed) != 0 {
+		t.Fatalf("dialed %v, want no connection", *dialed)
+	}
+}
+
+func TestPinnedDialUsesResolvedAddress(t *testing.T) {
+	dialed := stubResolver(t, map[string][]string{
+		"v16-webapp.tiktokcdn.com": {"93.184.216.34", "2606:2800:220:1::1"},
+	})
+
+	conn, err := pinnedDialContext(context.Background(), "tcp", "v16-webapp.tiktokcdn.com:443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	// The connection goes to the vetted IP, never back through DNS by name
+	if len(*dialed) != 1 || (*dialed)[0] != "93.184.216.34:443" {
+		t.Fatalf("dialed %v, want [93.184.216.34:443]", *dialed)
+	}
+}
+
+func TestProxyRejectsHTML(t *testing.T) {
+	videoUrl := fakeCDN(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte("<html>Access denied</html>"))
+	})
+
+	recorder := httptest.NewRecorder()
+	err := streamVideo(recorder, httptest.NewRequest("GET", "/proxy-video", nil), videoUrl)
+	if !errors.Is(err, ErrUnexpectedContent) {
+		t.Fatalf("err = %v, want ErrUnexpectedContent", err)
+	}
+	if recorder.Body.Len() != 0 {
+		t.Fatalf("relayed %q", recorder.Body.String())
+	}
+}
+
+func TestIsAllowedProxyHost(t *testing.T) {
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"v16-webapp-prime.tiktokcdn.com", true},
+		{"tiktokcdn.com", true},
+		{"V19.TIKTOKCDN-US.COM.", true},
+		{"v16m.tiktokv.com", true},
+		{"eviltiktokcdn.com", false},
+		{"tiktokcdn.com.evil.example", false},
+		{"example.com", false},
+		{"localhost", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := isAllowedProxyHost(tt.host); got != tt.want {
+			t.Errorf("isAllowedProxyHost(%q) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestProxyRedirects(t *testing.T) {
+	videoUrl := fakeCDN(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/to-cdn":
+			http.Redirect(w, r, "http://v19-webapp.tiktokcdn.com/clip.mp4", http.StatusFound)
+		case "/to-internal":
+			http.Redirect(w, r, "http://metadata.internal.example/latest", http.StatusFound)
+		default:
+			w.Header().Set("Content-Type", "video/mp4")
+			w.Write([]byte("mp4 bytes"))
+		}
+	})
+	base := strings.TrimSuffix(videoUrl, "/video/tos/clip.mp4")
+
+	recorder := httptest.NewRecorder()
+	if err := streamVideo(recorder, httptest.NewRequest("GET", "/proxy-video", nil), base+"/to-cdn"); err != nil {
+		t.Fatalf("redirect to another CDN host: %v", err)
+	}
+
+	err := streamVideo(httptest.NewRecorder(), httptest.NewRequest("GET", "/proxy-video", nil), base+"/to-internal")
+	if !errors.Is(err, ErrForbiddenTarget) {
+		t.Fatalf("redirect off the allowlist: err = %v, want ErrForbiddenTarget", err)
+	}
+}
+
+// setMaxProxyBytes lowers the proxy size limit for the duration of the test
+func setMaxProxyBytes(t *testing.T, limit int64) {
+	t.Helper()
+	original := MaxProxyBytes
+	MaxProxyBytes = limit
+	t.Cleanup(func() { MaxProxyBytes = original })
+}
+
+func TestProxyRejectsAnnouncedOversizeBody(t *testing.T) {
+	setMaxProxyBytes(t, 16)
+	videoUrl := fakeCDN(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "video/mp4")
+		w.Write([]byte(strings.Repeat("x", 64)))
+	})
+
+	recorder := httptest.NewRecorder()
+	err := streamVideo(recorder, httptest.NewRequest("GET", "/proxy-video", nil), videoUrl)
+	if !errors.Is(err, ErrResponseTooLarge) {
+		t.Fatalf("err = %v, want ErrResponseTooLarge", err)
+	}
+	if recorder.Body.Len() != 0 {
+		t.Fatalf("relayed %d bytes, want none", recorder.Body.Len())
+	}
+}
+
+func TestProxyCutsUnannouncedOversizeBody(t *testing.T) {
+	setMaxProxyBytes(t, 16)
+	videoUrl := fakeCDN(t, func(w http.ResponseWriter, r *http.Request) {
+		// Flushing first sends the body chunked, without a Content-Length to check
+		w.Header().Set("Content-Type", "video/mp4")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		w.Write([]byte(strings.Repeat("x", 64)))
+	})
+
+	recorder := httptest.NewRecorder()
+	err := streamVideo(recorder, httptest.NewRequest("GET", "/proxy-video", nil), videoUrl)
+	if !errors.Is(err, ErrResponseTooLarge) {
+		t.Fatalf("err = %v, want ErrResponseTooLarge", err)
+	}
+	if recorder.Body.Len() > 17 {
+		t.Fatalf("relayed %d bytes past a 16 byte limit", recorder.Body.Len())
+	}
+}
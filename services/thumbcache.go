@@ -0,0 +1,146 @@
+package services
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// thumbnailCache is the in-memory cache used by ProxyThumbnail, nil when disabled
+var thumbnailCache *ThumbnailCache
+
+// UseThumbnailCache enables the in-memory cache for proxied thumbnails
+func UseThumbnailCache(cache *ThumbnailCache) {
+	thumbnailCache = cache
+}
+
+// thumbnailCacheEntry is a cached image and when it goes stale
+type thumbnailCacheEntry struct {
+	key         string
+	body        []byte
+	contentType string
+	expiresAt   time.Time
+}
+
+// ThumbnailCache is an in-memory cache of proxied thumbnails keyed by a hash of the
+// image URL. Entries expire after a TTL, and the least recently used ones are evicted
+// once the cached bytes exceed maxBytes.
+type ThumbnailCache struct {
+	maxBytes int64
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*list.Element // Elements hold *thumbnailCacheEntry
+	recent  *list.List               // Most recently used at the front
+	size    int64
+}
+
+// NewThumbnailCache creates a cache holding up to maxBytes of images for ttl each
+func NewThumbnailCache(maxBytes int64, ttl time.Duration) *ThumbnailCache {
+	return &ThumbnailCache{
+		maxBytes: maxBytes,
+		ttl:      ttl,
+		entries:  make(map[string]*list.Element),
+		recent:   list.New(),
+	}
+}
+
+// key returns the cache key of imageUrl
+func (c *ThumbnailCache) key(imageUrl string) string {
+	sum := sha256.Sum256([]byte(imageUrl))
+	return hex.EncodeToString(sum[:])
+}
+
+// maxEntryBytes is the largest image worth caching, an eighth of the cache
+func (c *ThumbnailCache) maxEntryBytes() int64 {
+	return c.maxBytes / 8
+}
+
+// get returns the cached image of imageUrl unless it is missing or stale
+func (c *ThumbnailCache) get(imageUrl string) (*thumbnailCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[c.key(imageUrl)]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*thumbnailCacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.removeElement(element)
+		return nil, false
+	}
+	c.recent.MoveToFront(element)
+	return entry, true
+}
+
+// set stores the image of imageUrl and evicts the least recently used images past maxBytes
+func (c *ThumbnailCache) set(imageUrl, contentType string, body []byte) {
+	if int64(len(body)) > c.maxEntryBytes() {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := c.key(imageUrl)
+	if element, ok := c.entries[key]; ok {
+		c.removeElement(element)
+	}
+	entry := &thumbnailCacheEntry{key: key, body: body, contentType: contentType, expiresAt: time.Now().Add(c.ttl)}
+	c.entries[key] = c.recent.PushFront(entry)
+	c.size += int64(len(body))
+
+	for c.size > c.maxBytes {
+		c.removeElement(c.recent.Back())
+	}
+}
+
+// removeElement drops a cached image. The caller must hold c.mu.
+func (c *ThumbnailCache) removeElement(element *list.Element) {
+	entry := c.recent.Remove(element).(*thumbnailCacheEntry)
+	delete(c.entries, entry.key)
+	c.size -= int64(len(entry.body))
+}
+
+// serve writes the cached image of imageUrl to w with X-Cache: HIT, reporting whether
+// there was one
+func (c *ThumbnailCache) serve(w http.ResponseWriter, r *http.Request, imageUrl string) bool {
+	entry, ok := c.get(imageUrl)
+	if !ok {
+		return false
+	}
+
+	w.Header().Set("Content-Type", entry.contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(entry.body)))
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Header().Set("X-Cache", "HIT")
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		w.Write(entry.body)
+	}
+	return true
+}
+
+// cappedBuffer keeps a copy of what is written to it until it grows past limit, after
+// which it only remembers that it overflowed
+type cappedBuffer struct {
+	buf      bytes.Buffer
+	limit    int64
+	overflow bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if !b.overflow && int64(b.buf.Len()+len(p)) <= b.limit {
+		b.buf.Write(p)
+	} else {
+		b.overflow = true
+		b.buf.Reset()
+	}
+	return len(p), nil
+}
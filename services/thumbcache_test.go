@@ -0,0 +1,85 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useThumbnailCache enables cache for the duration of the test
+func useThumbnailCache(t *testing.T, cache *ThumbnailCache) {
+	original := thumbnailCache
+	thumbnailCache = cache
+	t.Cleanup(func() { thumbnailCache = original })
+}
+
+func TestThumbnailServedFromCache(t *testing.T) {
+	useThumbnailCache(t, NewThumbnailCache(1<<20, time.Hour))
+	stubResolver(t, map[string][]string{"v16-webapp.tiktokcdn.com": {"93.184.216.34"}})
+	fetches := 0
+	imageUrl := fakeCDN(t, func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write([]byte("jpeg bytes"))
+	})
+
+	get := func() *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		if err := ProxyThumbnail(recorder, httptest.NewRequest("GET", "/proxy-thumbnail", nil), imageUrl); err != nil {
+			t.Fatal(err)
+		}
+		return recorder
+	}
+
+	if first := get(); first.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("first request X-Cache %q, want MISS", first.Header().Get("X-Cache"))
+	}
+	second := get()
+	if second.Header().Get("X-Cache") != "HIT" {
+		t.Fatalf("second request X-Cache %q, want HIT", second.Header().Get("X-Cache"))
+	}
+	if second.Body.String() != "jpeg bytes" || second.Header().Get("Content-Type") != "image/jpeg" {
+		t.Fatalf("cached response %q as %q", second.Body.String(), second.Header().Get("Content-Type"))
+	}
+	if fetches != 1 {
+		t.Fatalf("the CDN was asked %d times, want 1", fetches)
+	}
+}
+
+func TestThumbnailCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	// Room for eight 10 byte images, the largest it keeps
+	cache := NewThumbnailCache(80, time.Hour)
+	image := []byte(strings.Repeat("x", 10))
+	for _, name := range []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"} {
+		cache.set(name, "image/jpeg", image)
+		// Keep a in use so it survives
+		cache.get("a")
+	}
+
+	if _, ok := cache.get("a"); !ok {
+		t.Fatal("the most recently used image was evicted")
+	}
+	if _, ok := cache.get("b"); ok {
+		t.Fatal("the least recently used image was kept past the size limit")
+	}
+	if cache.size > 80 {
+		t.Fatalf("cache holds %d bytes, limit 80", cache.size)
+	}
+
+	// Images larger than an eighth of the cache are not kept
+	cache.set("big", "image/jpeg", []byte(strings.Repeat("x", 11)))
+	if _, ok := cache.get("big"); ok {
+		t.Fatal("an oversized image was cached")
+	}
+}
+
+func TestThumbnailCacheExpiry(t *testing.T) {
+	cache := NewThumbnailCache(1<<20, time.Millisecond)
+	cache.set("a", "image/jpeg", []byte("x"))
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := cache.get("a"); ok {
+		t.Fatal("a stale image was served")
+	}
+}
@@ -2,25 +2,67 @@ package services
 
 import (
 	"context"
-	"errors"
+	"crypto/sha256"
+	"encoding/binary"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/chromedp/chromedp"
+	"golang.org/x/sync/singleflight"
 )
 
 // Video struct to hold the scraped video information
 type Video struct {
-	URL       string `json:"url"`
-	Thumbnail string `json:"thumbnail"`
-	Caption   string `json:"caption"`
-	User      string `json:"user"`
+	URL          string   `json:"url"`
+	VideoID      string   `json:"videoId"`
+	AuthorHandle string   `json:"authorHandle"`
+	AuthorName   string   `json:"authorName"`   // Display name, empty when TikTok did not render it
+	AuthorAvatar string   `json:"authorAvatar"` // Avatar image URL, empty when missing
+	Thumbnail    string   `json:"thumbnail"`    // Empty when the card had no usable image
+	HasThumbnail bool     `json:"hasThumbnail"` // False when Thumbnail is empty, show /thumbnail/placeholder instead
+	Caption      string   `json:"caption"`
+	User         string   `json:"user"`
+	Views        int      `json:"views"`
+	Likes        int      `json:"likes"`
+	Comments     int      `json:"comments"`
+	Hashtags     []string `json:"hashtags"`
+	Sound        *Sound   `json:"sound,omitempty"`
+}
+
+// Sound is the music or original audio a video uses
+type Sound struct {
+	Title  string `json:"title"`
+	Author string `json:"author"`
+	URL    string `json:"url"`
+}
+
+// SearchResult holds one page of videos along with pagination metadata
+type SearchResult struct {
+	Videos       []Video `json:"videos"`
+	Page         int     `json:"page"`
+	Offset       int     `json:"offset"`
+	ItemsPerPage int     `json:"itemsPerPage"`
+	HasNextPage  bool    `json:"hasNextPage"`
+	TotalFetched int     `json:"totalFetched"`
+
+	// Empty is set when the results list rendered without a single video, as opposed
+	// to a list that never appeared (ErrSelectorNotFound)
+	Empty bool `json:"empty"`
+
+	// Warnings describes the cards that failed to parse and were left out, only filled
+	// in when ReportWarnings is set
+	Warnings []string `json:"warnings,omitempty"`
+
+	// FromCache is set when the result was served from the search cache
+	FromCache bool `json:"-"`
 }
 
 // isValidThumbnailURL checks if the thumbnail URL is a valid HTTP/HTTPS URL
@@ -32,166 +74,706 @@ func isValidThumbnailURL(thumbnail string) bool {
 	return (parsedURL.Scheme == "http" || parsedURL.Scheme == "https") && !strings.HasPrefix(thumbnail, "data:image")
 }
 
-// SearchTikTokVideos with pagination
-func SearchTikTokVideos(query string, page int) ([]Video, error) {
-	var videos []Video
-	itemsPerPage := 6
-	scrollsNeeded := page // Number of scrolls needed based on the page
+// extractThumbnail returns the first valid HTTP(S) URL among the image's src and its
+// lazy-loading attributes, since lazily loaded cards keep a data:image placeholder in src
+func extractThumbnail(img *goquery.Selection) (string, bool) {
+	for _, attr := range []string{"src", "data-src", "data-lazy"} {
+		if thumbnail, exists := img.Attr(attr); exists && isValidThumbnailURL(thumbnail) {
+			return thumbnail, true
+		}
+	}
+	return "", false
+}
 
-	// Create context for chromedp
-	ctx, cancel := chromedp.NewContext(context.Background())
-	defer cancel()
+// parseCount converts abbreviated counts like "1.2M" or "34.5K" into integers,
+// returning 0 when the text cannot be parsed
+func parseCount(text string) int {
+	text = strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(text), ",", ""))
+	if text == "" {
+		return 0
+	}
 
-	// Initialize the HTML content
-	var htmlContent string
-	tiktokSearchURL := fmt.Sprintf("https://www.tiktok.com/search?q=%s", query)
-
-	// Navigate and scroll to load more content
-	for i := 0; i < scrollsNeeded; i++ {
-		err := chromedp.Run(ctx,
-			chromedp.Navigate(tiktokSearchURL),
-			chromedp.WaitVisible(`div[data-e2e="search_top-item-list"]`, chromedp.ByQuery),
-			chromedp.ScrollIntoView(`div[data-e2e="search_top-item-list"]`, chromedp.ByQuery),
-			chromedp.Sleep(2*time.Second), // Adjust sleep time if necessary
-			chromedp.OuterHTML("html", &htmlContent),
-		)
-		if err != nil {
-			log.Printf("Error while scrolling: %v", err)
-			return nil, err
-		}
+	multiplier := 1.0
+	switch {
+	case strings.HasSuffix(text, "K"):
+		multiplier = 1e3
+	case strings.HasSuffix(text, "M"):
+		multiplier = 1e6
+	case strings.HasSuffix(text, "B"):
+		multiplier = 1e9
+	}
+	if multiplier > 1 {
+		text = text[:len(text)-1]
+	}
 
-		// Parse the loaded HTML with goquery
-		doc, err := goquery.NewDocumentFromReader(strings.NewReader(htmlContent))
-		if err != nil {
-			log.Printf("Failed to parse HTML: %v", err)
-			return nil, err
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil || value < 0 {
+		return 0
+	}
+	return int(value * multiplier)
+}
+
+// hashtagPattern matches #word tokens inside captions
+var hashtagPattern = regexp.MustCompile(`#([\p{L}\p{N}_]+)`)
+
+// parseHashtags returns the lowercase, deduplicated hashtags of a caption without the
+// leading #, always as a non-nil slice so it encodes as [] in JSON
+func parseHashtags(caption string) []string {
+	hashtags := []string{}
+	seen := make(map[string]struct{})
+
+	for _, match := range hashtagPattern.FindAllStringSubmatch(caption, -1) {
+		tag := strings.ToLower(match[1])
+		if _, ok := seen[tag]; ok {
+			continue
 		}
+		seen[tag] = struct{}{}
+		hashtags = append(hashtags, tag)
+	}
+	return hashtags
+}
 
-		// Extract video data from HTML
-		doc.Find(`div[data-e2e="search_top-item"]`).Each(func(i int, s *goquery.Selection) {
-			// Stop once we have enough items for the page
-			if len(videos) >= page*itemsPerPage {
-				return
-			}
+// extractCount reads an engagement count from the first element matching selector
+func extractCount(s *goquery.Selection, selector string) int {
+	return parseCount(s.Find(selector).First().Text())
+}
 
-			videoLink, exists := s.Find("a").Attr("href")
-			if !exists {
-				return
-			}
+// SearchTikTokVideos with pagination, serving repeated queries from the cache
+func SearchTikTokVideos(ctx context.Context, query string, page int, opts SearchOptions) (*SearchResult, error) {
+	return StreamSearchTikTokVideos(ctx, query, page, opts, nil)
+}
 
-			if !strings.HasPrefix(videoLink, "http") {
-				videoLink = "https://www.tiktok.com" + videoLink
-			}
+// StreamSearchTikTokVideos searches like SearchTikTokVideos and also calls emit with
+// each video of the requested page as soon as it is extracted. emit may be nil.
+func StreamSearchTikTokVideos(ctx context.Context, query string, page int, opts SearchOptions, emit func(Video)) (*SearchResult, error) {
+	searchesTotal.Inc()
 
-			thumbnail, exists := s.Find("img").Attr("src")
-			if !exists || !isValidThumbnailURL(thumbnail) {
-				return // Skip this video if the thumbnail is not a valid HTTP/HTTPS URL
-			}
+	// Reject blank queries and unknown filters before spending a scrape on them
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, ErrEmptyQuery
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
 
-			descSection := s.Next()
-			caption := descSection.Find(`div[data-e2e="search-card-video-caption"]`).Text()
-			user, exists := descSection.Find(`a[data-e2e="search-card-user-link"]`).Attr("href")
-			if !exists {
-				return
+	key := searchCacheKey(query, page, opts)
+	if result, ok := resultsCache.get(key); ok {
+		if emit != nil {
+			for _, video := range result.Videos {
+				emit(video)
 			}
+		}
+
+		// Flag a copy, the cached result is shared between requests
+		hit := *result
+		hit.FromCache = true
+		return &hit, nil
+	}
+
+	// Streams need their own scrape to receive videos as they are extracted
+	if emit != nil {
+		return scrapeAndCacheSearch(ctx, key, query, page, opts, emit)
+	}
+
+	// Identical concurrent searches share one scrape. It is detached from the first
+	// caller so that caller going away does not fail everyone else, and each caller
+	// still stops waiting when its own context ends.
+	flight := searchFlights.DoChan(key, func() (any, error) {
+		return scrapeAndCacheSearch(context.WithoutCancel(ctx), key, query, page, opts, nil)
+	})
+	select {
+	case res := <-flight:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.(*SearchResult), nil
+	case <-ctx.Done():
+		return nil, context.Cause(ctx)
+	}
+}
+
+// searchFlights coalesces concurrent scrapes of the same search
+var searchFlights singleflight.Group
+
+// searchScraper scrapes one page of a search, swapped out by tests that must not start
+// a browser
+var searchScraper = scrapeSearch
+
+// scrapeAndCacheSearch scrapes a search and caches the result
+func scrapeAndCacheSearch(ctx context.Context, key, query string, page int, opts SearchOptions, emit func(Video)) (*SearchResult, error) {
+	start := time.Now()
+	result, err := searchScraper(ctx, query, page, opts, emit)
+	observeScrape("search", start, err)
+	if err != nil {
+		return nil, err
+	}
+	resultsCache.set(key, result)
+	return result, nil
+}
+
+// parseSearchCard converts a search result card into a Video
+func parseSearchCard(s *goquery.Selection) (Video, bool) {
+	videoLink, exists := cardLink(s)
+	if !exists {
+		return Video{}, false
+	}
+
+	// Lazy or broken images leave the thumbnail empty rather than losing the video
+	thumbnail, hasThumbnail := extractThumbnail(s.Find("img"))
+
+	descSection := s.Next()
+	caption := descSection.Find(selectors.SearchCaption).Text()
+	userLink := descSection.Find(selectors.SearchUserLink)
+	user, exists := userLink.Attr("href")
+	if !exists {
+		return Video{}, false
+	}
+
+	// The user link wraps the author's avatar and name, both optional
+	authorName := strings.TrimSpace(userLink.Find(selectors.SearchUserName).First().Text())
+	authorAvatar, _ := extractThumbnail(userLink.Find("img").First())
+
+	// Engagement counts may live in either half of the card, missing ones stay 0
+	card := s.AddSelection(descSection)
+
+	return Video{
+		URL:          videoLink,
+		Thumbnail:    thumbnail,
+		HasThumbnail: hasThumbnail,
+		Caption:      caption,
+		User:         "https://www.tiktok.com" + user,
+		AuthorName:   authorName,
+		AuthorAvatar: authorAvatar,
+		Views:        extractCount(card, selectors.ViewCount),
+		Likes:        extractCount(card, selectors.LikeCount),
+		Comments:     extractCount(card, selectors.CommentCount),
+		Hashtags:     parseHashtags(caption),
+		Sound:        extractSound(descSection),
+	}, true
+}
+
+// extractSound reads the sound linked from a search card, returning nil when there is none
+func extractSound(s *goquery.Selection) *Sound {
+	link := s.Find(`a[href*="/music/"]`).First()
+	href, exists := link.Attr("href")
+	if !exists {
+		return nil
+	}
+	if !strings.HasPrefix(href, "http") {
+		href = "https://www.tiktok.com" + href
+	}
+
+	// Sound links read "<title> - <author>", e.g. "original sound - someone"
+	title := strings.TrimSpace(link.Text())
+	author := ""
+	if dash := strings.LastIndex(title, " - "); dash >= 0 {
+		title, author = strings.TrimSpace(title[:dash]), strings.TrimSpace(title[dash+3:])
+	}
+	return &Sound{Title: title, Author: author, URL: href}
+}
+
+// scrapeSearch scrapes a page of search results
+func scrapeSearch(ctx context.Context, query string, page int, opts SearchOptions, emit func(Video)) (*SearchResult, error) {
+	f := feed{
+		url:          searchURL(query, opts),
+		listSelector: selectors.SearchList,
+		itemSelector: selectors.SearchItem,
+		parseCard:    parseSearchCard,
+		onVideo:      emit,
+		perPage:      opts.Limit,
+		offset:       opts.Offset,
+	}
 
-			videos = append(videos, Video{
-				URL:       videoLink,
-				Thumbnail: thumbnail,
-				Caption:   caption,
-				User:      "https://www.tiktok.com" + user,
-			})
-		})
+	// Skip the browser when the raw HTML already embeds the page
+	if result, ok := staticFeed(ctx, f, page); ok {
+		return result, nil
 	}
+	return scrapeFeed(ctx, f, page)
+}
 
-	// Calculate the start and end index for pagination
-	start := (page - 1) * itemsPerPage
-	end := start + itemsPerPage
+// SearchByHashtag scrapes a page of videos from a hashtag's challenge page
+func SearchByHashtag(ctx context.Context, tag string, page int, opts PageOptions) (*SearchResult, error) {
+	tag = strings.TrimPrefix(strings.TrimSpace(tag), "#")
+	if tag == "" {
+		return nil, fmt.Errorf("%w: hashtag is required", ErrInvalidParameter)
+	}
+
+	return scrapeFeedWindow(ctx, feed{
+		url:          "https://www.tiktok.com/tag/" + url.PathEscape(tag),
+		listSelector: selectors.HashtagList,
+		itemSelector: selectors.HashtagItem,
+		parseCard:    parseGridCard,
+	}, page, opts)
+}
+
+// GetTrendingVideos scrapes a page of trending videos from the explore feed
+func GetTrendingVideos(ctx context.Context, page int, opts PageOptions) (*SearchResult, error) {
+	return scrapeFeedWindow(ctx, feed{
+		url:             "https://www.tiktok.com/explore",
+		listSelector:    selectors.ExploreList,
+		itemSelector:    selectors.ExploreItem,
+		parseCard:       parseGridCard,
+		toleratePartial: true,
+	}, page, opts)
+}
+
+// GetUserVideos scrapes a page of videos from a user's profile grid
+func GetUserVideos(ctx context.Context, username string, page int, opts PageOptions) (*SearchResult, error) {
+	username = strings.TrimPrefix(strings.TrimSpace(username), "@")
+	if username == "" {
+		return nil, fmt.Errorf("%w: username is required", ErrInvalidParameter)
+	}
+
+	return scrapeFeedWindow(ctx, feed{
+		url:          "https://www.tiktok.com/@" + url.PathEscape(username),
+		listSelector: selectors.UserList,
+		itemSelector: selectors.UserItem,
+		parseCard:    parseGridCard,
+		unavailable: []pageMarker{
+			{selector: selectors.UserNotFound, err: ErrProfileNotFound},
+			{selector: selectors.UserPrivate, err: ErrProfilePrivate},
+		},
+	}, page, opts)
+}
 
-	// Safely slice videos based on pagination
-	if start >= len(videos) {
-		return nil, fmt.Errorf("no more data available")
+// GetRelatedVideos scrapes a page of the videos TikTok recommends next to a video. A video
+// page without recommendations gives an empty result rather than an error.
+func GetRelatedVideos(ctx context.Context, videoPageUrl string, page int, opts PageOptions) (*SearchResult, error) {
+	if _, err := url.ParseRequestURI(videoPageUrl); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidURL, videoPageUrl)
 	}
-	if end > len(videos) {
-		end = len(videos)
+
+	return scrapeFeedWindow(ctx, feed{
+		url:          videoPageUrl,
+		listSelector: selectors.RelatedList,
+		itemSelector: selectors.RelatedItem,
+		parseCard:    parseGridCard,
+		listOptional: true,
+		skipEmbedded: true,
+	}, page, opts)
+}
+
+// Video container formats a caller may ask GetVideoUrl for
+const (
+	FormatMP4  = "mp4"
+	FormatWebM = "webm"
+)
+
+// ValidVideoFormat reports whether format is empty or a container GetVideoUrl understands
+func ValidVideoFormat(format string) bool {
+	return format == "" || format == FormatMP4 || format == FormatWebM
+}
+
+// GetVideoUrl scrapes the video URL from a TikTok video page, preferring a source in
+// format (mp4 when empty). When no source has that format the best other one is
+// returned, and actualFormat tells which container the URL points at.
+func GetVideoUrl(ctx context.Context, videoPageUrl, format string) (videoUrl, actualFormat string, err error) {
+	videoURLFetchesTotal.Inc()
+	if !ValidVideoFormat(format) {
+		return "", "", fmt.Errorf("%w: unknown format %q", ErrInvalidParameter, format)
 	}
 
-	// Return only the requested page of videos
-	return videos[start:end], nil
+	start := time.Now()
+	videoUrl, actualFormat, err = scrapeVideoUrl(ctx, videoPageUrl, format)
+	observeScrape("video_url", start, err)
+	return videoUrl, actualFormat, err
 }
 
-// GetVideoUrl scrapes the video URL from a TikTok video page and follows redirects
-func GetVideoUrl(videoPageUrl string) (string, error) {
+// videoPageSelector matches the first element of a video page that carries the video,
+// or the captcha TikTok shows instead
+var videoPageSelector = "video source, script#__UNIVERSAL_DATA_FOR_REHYDRATION__, script#SIGI_STATE, " + captchaSelector()
+
+// scrapeVideoUrl loads a video page in a pooled tab and extracts its playback URL
+func scrapeVideoUrl(ctx context.Context, videoPageUrl, format string) (string, string, error) {
 	// Validate if the input is a valid URL
 	_, err := url.ParseRequestURI(videoPageUrl)
 	if err != nil {
-		return "", errors.New("invalid video URL")
+		return "", "", fmt.Errorf("%w: %s", ErrInvalidURL, videoPageUrl)
+	}
+
+	// Skip the browser when the raw HTML already embeds the video
+	if videoUrl, actualFormat := staticVideoURL(ctx, videoPageUrl, format); videoUrl != "" {
+		return videoUrl, actualFormat, nil
+	}
+
+	// Load the page in a pooled tab
+	htmlContent, err := loadPageHTML(ctx, videoPageUrl, videoPageSelector)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Load the HTML content into goquery
+	stop := timePhase(ctx, "parse")
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(htmlContent))
+	if err != nil {
+		stop()
+		log.Printf("Failed to parse HTML: %v", err)
+		return "", "", err
+	}
+
+	videoUrl, actualFormat := videoURLFromDoc(doc, videoPageUrl, format)
+	stop()
+
+	// Check if a video URL was found, telling a verification page apart from a missing video
+	if videoUrl == "" && isCaptchaPage(doc) {
+		return "", "", ErrCaptchaRequired
+	}
+	if videoUrl == "" {
+		return "", "", fmt.Errorf("%w: no source in page markup or embedded data", ErrVideoNotFound)
+	}
+
+	return videoUrl, actualFormat, nil
+}
+
+// sourceResolution reads the resolution hinted by a <source> element's attributes, 0 if unknown
+func sourceResolution(s *goquery.Selection) int {
+	for _, attr := range []string{"res", "data-res", "size", "height", "data-height"} {
+		if value, exists := s.Attr(attr); exists {
+			if res, err := strconv.Atoi(strings.TrimSuffix(value, "p")); err == nil {
+				return res
+			}
+		}
+	}
+	return 0
+}
+
+// videoURLFromDoc prefers the best <video> source in format, falling back to the
+// embedded JSON, and returns the URL of the post pageUrl points at with its format.
+// A page whose embedded JSON lacks that post shows another one, so it yields nothing.
+func videoURLFromDoc(doc *goquery.Document, pageUrl, format string) (string, string) {
+	postID := parsePostID(pageUrl)
+	if _, ok := postItem(doc, postID); !ok && len(embeddedItems(doc)) > 0 {
+		return "", ""
+	}
+
+	if videoUrl, actualFormat := selectVideoSource(doc, format); videoUrl != "" {
+		return videoUrl, actualFormat
+	}
+	videoUrl := embeddedVideoURL(doc, postID)
+	return videoUrl, formatFromURL(videoUrl)
+}
+
+// loadPageHTML returns the HTML of pageUrl once waitSelector is in the DOM, fast-failing
+// while the circuit breaker is open
+func loadPageHTML(ctx context.Context, pageUrl, waitSelector string) (string, error) {
+	if err := scrapeBreaker.allow(); err != nil {
+		return "", err
+	}
+
+	htmlContent, err := onFreshTab(ctx, func() (string, error) {
+		return navigatePage(ctx, pageUrl, waitSelector)
+	})
+	scrapeBreaker.record(err)
+	return htmlContent, err
+}
+
+// navigatePage navigates a pooled tab to pageUrl and returns the rendered HTML
+func navigatePage(ctx context.Context, pageUrl, waitSelector string) (string, error) {
+	// Borrow a tab from the browser pool
+	stop := timePhase(ctx, "acquire")
+	tab, err := browserPool.Acquire(ctx)
+	stop()
+	if err != nil {
+		return "", err
 	}
+	defer browserPool.Release(tab)
 
-	// Set up a context with chromedp
-	ctx, cancel := chromedp.NewContext(context.Background())
+	// Bound the scrape so a slow page or a client disconnect cannot hang the tab
+	runCtx, cancel := tab.scrapeContext(ctx)
 	defer cancel()
 
+	// Everything is read from the markup, so nothing needs to load but the page itself
+	if err := tab.blockResources(runCtx, false); err != nil {
+		return "", err
+	}
+
 	// Variable to store the HTML content
 	var htmlContent string
 
-	// Use chromedp to navigate to the video page and retrieve the HTML
-	err = chromedp.Run(ctx,
-		chromedp.Navigate(videoPageUrl),
-		chromedp.Sleep(2*time.Second), // Wait for page to load
-		chromedp.OuterHTML("html", &htmlContent),
-	)
+	// Use chromedp to navigate to the page, retrying transient failures within NavTimeout
+	navCtx, cancelNav := navContext(runCtx)
+	err = withRetry(navCtx, func() error {
+		stop := timePhase(ctx, "nav")
+		err := tab.run(navCtx, chromedp.Navigate(pageUrl))
+		stop()
+		if err != nil {
+			return err
+		}
+
+		defer timePhase(ctx, "wait")()
+		return tab.run(navCtx, chromedp.WaitReady(waitSelector, chromedp.ByQuery))
+	})
+	cancelNav()
 	if err != nil {
 		return "", err
 	}
 
-	// Load the HTML content into goquery
-	doc, err := goquery.NewDocumentFromReader(strings.NewReader(htmlContent))
-	if err != nil {
-		log.Printf("Failed to parse HTML: %v", err)
+	// Let lazy content render, then retrieve the HTML
+	if err := tab.run(runCtx, settle(), chromedp.OuterHTML("html", &htmlContent)); err != nil {
 		return "", err
 	}
+	return htmlContent, nil
+}
 
-	// Find the <video> tag and select the third <source> element inside it
-	var videoUrl string
-	doc.Find("video source").EachWithBreak(func(i int, s *goquery.Selection) bool {
-		if i == 2 { // Select the third <source> (index starts from 0)
-			videoUrl, _ = s.Attr("src")
-			return false // Stop iteration once the third <source> is found
+// selectVideoSource picks the highest quality <video> source in format (mp4 when empty),
+// falling back to the highest quality source of any format, and returns its format
+func selectVideoSource(doc *goquery.Document, format string) (string, string) {
+	if format == "" {
+		format = FormatMP4
+	}
+
+	var best, fallback, fallbackFormat string
+	bestRes, fallbackRes := -1, -1
+
+	doc.Find("video source").Each(func(i int, s *goquery.Selection) {
+		// Sources need the same HTTP(S) check as thumbnails
+		src, _ := s.Attr("src")
+		if !isValidThumbnailURL(src) {
+			return
+		}
+
+		res := sourceResolution(s)
+		sourceFormat := videoSourceFormat(s, src)
+		if sourceFormat == format && res > bestRes {
+			best, bestRes = src, res
+		}
+		if res > fallbackRes {
+			fallback, fallbackFormat, fallbackRes = src, sourceFormat, res
 		}
-		return true
 	})
 
-	// Check if a video URL was found
-	if videoUrl == "" {
-		return "", errors.New("video source not found")
+	if best != "" {
+		return best, format
 	}
+	return fallback, fallbackFormat
+}
 
-	return videoUrl, nil
+// videoSourceFormat reads the container of a <source> from its type attribute, then from
+// its URL, assuming mp4 like browsers do when neither says
+func videoSourceFormat(s *goquery.Selection, src string) string {
+	switch sourceType, _ := s.Attr("type"); {
+	case strings.HasPrefix(sourceType, "video/webm"):
+		return FormatWebM
+	case strings.HasPrefix(sourceType, "video/mp4"):
+		return FormatMP4
+	}
+	return formatFromURL(src)
 }
 
-// ProxyVideoContent fetches video content directly from the TikTok CDN
-func ProxyVideoContent(videoUrl string) ([]byte, error) {
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", videoUrl, nil)
+// formatFromURL guesses the container of a video URL from its extension or TikTok's
+// mime_type parameter, defaulting to mp4
+func formatFromURL(videoUrl string) string {
+	parsedURL, err := url.Parse(videoUrl)
 	if err != nil {
-		return nil, err
+		return FormatMP4
+	}
+	if strings.HasSuffix(strings.ToLower(parsedURL.Path), ".webm") || parsedURL.Query().Get("mime_type") == "video_webm" {
+		return FormatWebM
+	}
+	return FormatMP4
+}
+
+// ProxyVideoContent streams video content from the TikTok CDN to the client,
+// forwarding Range requests so video players can seek
+func ProxyVideoContent(w http.ResponseWriter, r *http.Request, videoUrl string) error {
+	proxyRequestsTotal.Inc()
+
+	start := time.Now()
+	err := validateProxyTarget(r.Context(), videoUrl)
+	if err == nil {
+		err = streamVideo(w, r, videoUrl)
+	}
+	// Report why the request context ended rather than the transport's generic error
+	if err != nil && r.Context().Err() != nil {
+		err = context.Cause(r.Context())
+	}
+	observeScrape("proxy", start, err)
+	return err
+}
+
+// streamVideo copies the upstream video to w without buffering it in memory
+func streamVideo(w http.ResponseWriter, r *http.Request, videoUrl string) error {
+	// Serve frequently replayed videos from disk without touching the CDN
+	if videoCache != nil && videoCache.serve(w, r, videoUrl) {
+		return nil
+	}
+
+	// A HEAD only needs the upstream headers, so skip the body upstream as well
+	method := http.MethodGet
+	if r.Method == http.MethodHead {
+		method = http.MethodHead
+	}
+	req, err := http.NewRequestWithContext(r.Context(), method, videoUrl, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidURL, err)
 	}
 
 	// Set headers to mimic a browser
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/89.0.4389.82 Safari/537.36")
-	req.Header.Set("Referer", "https://www.tiktok.com/")
-	req.Header.Set("Accept-Language", "en-US,en;q=0.9")
+	setBrowserHeaders(req)
+	setCDNHeaders(req)
 
-	resp, err := client.Do(req)
+	// Forward the Range header so the CDN only returns the requested bytes
+	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" {
+		req.Header.Set("Range", rangeHeader)
+	}
+
+	resp, err := proxyClient.Do(req)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("received status code %d", resp.StatusCode)
+	if err := checkUpstreamStatus(resp); err != nil {
+		return err
+	}
+
+	// HLS playlists are rewritten so their segments come back through the proxy
+	if isHLSPlaylist(resp) {
+		return serveHLSPlaylist(w, r, resp)
+	}
+
+	// Never relay HTML or other content the CDN might return in place of the video
+	if err := checkVideoContentType(resp); err != nil {
+		return err
+	}
+	if err := checkProxySize(resp); err != nil {
+		return err
+	}
+
+	// Skip the body entirely when the client already has this version
+	lastModified := videoLastModified(videoUrl, resp)
+	etag := videoETag(videoUrl, resp)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	if notModified(r, etag, lastModified) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	// Propagate the headers players rely on for partial content. Range requests are
+	// always forwarded, so advertise them even when the CDN leaves the header out.
+	for _, header := range []string{"Content-Length", "Content-Range"} {
+		if value := resp.Header.Get(header); value != "" {
+			w.Header().Set(header, value)
+		}
+	}
+	w.Header().Set("Accept-Ranges", "bytes")
+	contentType := videoContentType(resp)
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(resp.StatusCode)
+
+	if r.Method == http.MethodHead {
+		return nil
+	}
+
+	// Copy the body in chunks instead of buffering the whole video in memory, cutting
+	// the stream short if it grows past MaxProxyBytes
+	if videoCache == nil || !isCompleteResponse(resp) {
+		_, err = copyLimited(w, resp.Body)
+		return err
+	}
+
+	// Write a copy of complete responses to the disk cache while streaming
+	cacheWriter, cacheErr := videoCache.newWriter(videoUrl, lastModified, videoCacheMeta{ContentType: contentType, ETag: etag})
+	if cacheErr != nil {
+		_, err = copyLimited(w, resp.Body)
+		return err
+	}
+
+	written, err := copyLimited(io.MultiWriter(w, cacheWriter), resp.Body)
+	if err != nil || (resp.ContentLength >= 0 && written != resp.ContentLength) {
+		cacheWriter.abort()
+		return err
+	}
+	cacheWriter.commit()
+	return nil
+}
+
+// videoContentType keeps specific video types such as video/mp2t for HLS segments and
+// labels generic binary responses as mp4
+func videoContentType(resp *http.Response) string {
+	contentType := resp.Header.Get("Content-Type")
+	if strings.HasPrefix(strings.ToLower(contentType), "video/") {
+		return contentType
+	}
+	return "video/mp4"
+}
+
+// checkUpstreamStatus maps a CDN error status to the matching sentinel error
+func checkUpstreamStatus(resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent:
+		return nil
+	case http.StatusNotFound, http.StatusGone:
+		return fmt.Errorf("%w: received status code %d", ErrVideoNotFound, resp.StatusCode)
+	case http.StatusForbidden, http.StatusTooManyRequests:
+		return fmt.Errorf("%w: received status code %d", ErrBlocked, resp.StatusCode)
+	default:
+		return fmt.Errorf("received status code %d", resp.StatusCode)
+	}
+}
+
+// videoETag builds a weak ETag from the upstream URL, Last-Modified and full size
+func videoETag(videoUrl string, resp *http.Response) string {
+	// For partial responses the full size is the part after the slash in Content-Range
+	size := resp.Header.Get("Content-Length")
+	if contentRange := resp.Header.Get("Content-Range"); contentRange != "" {
+		if slash := strings.LastIndex(contentRange, "/"); slash >= 0 {
+			size = contentRange[slash+1:]
+		}
+	}
+
+	return computeETag(videoUrl, videoLastModified(videoUrl, resp).UTC().Format(http.TimeFormat), size)
+}
+
+// lastModifiedEpoch is the earliest date videoLastModified makes up
+var lastModifiedEpoch = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// videoLastModified returns the upstream Last-Modified or, when the CDN leaves it out, a
+// date derived from a hash of the URL. The made-up date is stable for a URL and in the
+// past, so conditional requests keep working across restarts.
+func videoLastModified(videoUrl string, resp *http.Response) time.Time {
+	if lastModified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		return lastModified
 	}
+	return synthesizedLastModified(videoUrl)
+}
+
+// synthesizedLastModified spreads URLs over the five years following lastModifiedEpoch
+func synthesizedLastModified(videoUrl string) time.Time {
+	sum := sha256.Sum256([]byte(videoUrl))
+	span := uint64(5 * 365 * 24 * time.Hour / time.Second)
+	return lastModifiedEpoch.Add(time.Duration(binary.BigEndian.Uint64(sum[:8])%span) * time.Second)
+}
 
-	return io.ReadAll(resp.Body)
+// notModified reports whether the client's cached copy is current, by If-None-Match or,
+// when that is absent, If-Modified-Since at one-second precision
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		return etagMatches(ifNoneMatch, etag)
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	return err == nil && !lastModified.Truncate(time.Second).After(since)
+}
+
+// computeETag hashes the URL, Last-Modified and size into a weak ETag
+func computeETag(videoUrl, lastModified, size string) string {
+	sum := sha256.Sum256([]byte(videoUrl + "|" + lastModified + "|" + size))
+	return fmt.Sprintf(`W/"%x"`, sum[:16])
+}
+
+// etagMatches reports whether an If-None-Match header matches etag using weak comparison
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
 }
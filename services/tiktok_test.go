@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+// fakeCDN serves handler as if it were TikTok's CDN: proxyClient connects every request
+// to it, whatever the host, and the returned URL is on an allowed CDN host
+func fakeCDN(t *testing.T, handler http.HandlerFunc) string {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	original := proxyClient
+	proxyClient = &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+			},
+		},
+		CheckRedirect: original.CheckRedirect,
+	}
+	t.Cleanup(func() { proxyClient = original })
+	return "http://v16-webapp.tiktokcdn.com/video/tos/clip.mp4"
+}
+
+func TestStreamVideoNotModified(t *testing.T) {
+	videoUrl := fakeCDN(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "video/mp4")
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2023 15:04:05 GMT")
+		w.Write([]byte("mp4 bytes"))
+	})
+
+	first := httptest.NewRecorder()
+	if err := streamVideo(first, httptest.NewRequest("GET", "/proxy-video", nil), videoUrl); err != nil {
+		t.Fatal(err)
+	}
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("first request: status %d, ETag %q", first.Code, etag)
+	}
+
+	// Replaying the ETag gets a body-less 304
+	req := httptest.NewRequest("GET", "/proxy-video", nil)
+	req.Header.Set("If-None-Match", etag)
+	second := httptest.NewRecorder()
+	if err := streamVideo(second, req, videoUrl); err != nil {
+		t.Fatal(err)
+	}
+	if second.Code != http.StatusNotModified {
+		t.Fatalf("status %d, want 304", second.Code)
+	}
+	if second.Body.Len() != 0 {
+		t.Fatalf("304 carried a %d byte body", second.Body.Len())
+	}
+
+	// A stale ETag gets the video again
+	req = httptest.NewRequest("GET", "/proxy-video", nil)
+	req.Header.Set("If-None-Match", `W/"stale"`)
+	third := httptest.NewRecorder()
+	if err := streamVideo(third, req, videoUrl); err != nil {
+		t.Fatal(err)
+	}
+	if third.Code != http.StatusOK || third.Body.String() != "mp4 bytes" {
+		t.Fatalf("stale ETag: status %d, body %q", third.Code, third.Body.String())
+	}
+}
+
+func TestStreamVideoHead(t *testing.T) {
+	upstreamMethod := ""
+	videoUrl := fakeCDN(t, func(w http.ResponseWriter, r *http.Request) {
+		upstreamMethod = r.Method
+		w.Header().Set("Content-Type", "video/mp4")
+		w.Header().Set("Content-Length", "1048576")
+	})
+
+	recorder := httptest.NewRecorder()
+	if err := streamVideo(recorder, httptest.NewRequest("HEAD", "/proxy-video", nil), videoUrl); err != nil {
+		t.Fatal(err)
+	}
+
+	if upstreamMethod != http.MethodHead {
+		t.Fatalf("upstream got %s, want HEAD", upstreamMethod)
+	}
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200", recorder.Code)
+	}
+	for header, want := range map[string]string{
+		"Content-Length": "1048576",
+		"Content-Type":   "video/mp4",
+		"Accept-Ranges":  "bytes",
+	} {
+		if got := recorder.Header().Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+	if recorder.Body.Len() != 0 {
+		t.Fatalf("HEAD carried a %d byte body", recorder.Body.Len())
+	}
+}
+
+func TestETagMatches(t *testing.T) {
+	etag := `W/"abc"`
+	tests := []struct {
+		ifNoneMatch string
+		want        bool
+	}{
+		{`W/"abc"`, true},
+		{`"abc"`, true},
+		{`W/"other", W/"abc"`, true},
+		{`*`, true},
+		{`W/"other"`, false},
+		{``, false},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.ifNoneMatch, etag); got != tt.want {
+			t.Errorf("etagMatches(%q) = %v, want %v", tt.ifNoneMatch, got, tt.want)
+		}
+	}
+}
+
+func TestStreamSearchEmitsVideos(t *testing.T) {
+	scrapes := 0
+	stubSearch(t, func(ctx context.Context, query string, page int, opts SearchOptions, emit func(Video)) (*SearchResult, error) {
+		scrapes++
+		videos := []Video{{VideoID: "1"}, {VideoID: "2"}}
+		for _, video := range videos {
+			emit(video)
+		}
+		return &SearchResult{Videos: videos, Page: page}, nil
+	})
+
+	// A fake emitter standing in for the event stream
+	var emitted []Video
+	emit := func(video Video) { emitted = append(emitted, video) }
+
+	if _, err := StreamSearchTikTokVideos(context.Background(), "cats", 1, SearchOptions{}, emit); err != nil {
+		t.Fatal(err)
+	}
+	if got := videoIDs(emitted); !slices.Equal(got, []string{"1", "2"}) {
+		t.Fatalf("emitted %v, want [1 2]", got)
+	}
+
+	// A cached result is replayed to the emitter without scraping again
+	emitted = nil
+	result, err := StreamSearchTikTokVideos(context.Background(), "cats", 1, SearchOptions{}, emit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.FromCache || scrapes != 1 {
+		t.Fatalf("FromCache %v after %d scrapes, want a cache hit after 1", result.FromCache, scrapes)
+	}
+	if got := videoIDs(emitted); !slices.Equal(got, []string{"1", "2"}) {
+		t.Fatalf("replayed %v, want [1 2]", got)
+	}
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// timingKey is the context key of the Timing of a request
+type timingKey struct{}
+
+// Timing adds up how long each phase of the scrapes behind a request took
+type Timing struct {
+	start time.Time
+
+	mu     sync.Mutex
+	order  []string
+	phases map[string]time.Duration
+}
+
+// WithTiming returns a context whose scrapes record their phases in the returned Timing
+func WithTiming(ctx context.Context) (context.Context, *Timing) {
+	timing := &Timing{start: time.Now(), phases: make(map[string]time.Duration)}
+	return context.WithValue(ctx, timingKey{}, timing), timing
+}
+
+// timePhase starts timing the phase name of the scrape running in ctx and returns the
+// function that ends it. Phases repeated by retries or scrolls add up. It does nothing
+// when ctx carries no Timing.
+func timePhase(ctx context.Context, name string) func() {
+	timing, ok := ctx.Value(timingKey{}).(*Timing)
+	if !ok {
+		return func() {}
+	}
+
+	start := time.Now()
+	return func() {
+		elapsed := time.Since(start)
+
+		timing.mu.Lock()
+		defer timing.mu.Unlock()
+		if _, seen := timing.phases[name]; !seen {
+			timing.order = append(timing.order, name)
+		}
+		timing.phases[name] += elapsed
+	}
+}
+
+// String formats the phases in the order they first ran, followed by the total time
+// since WithTiming, e.g. "nav=820ms;wait=1200ms;parse=45ms;total=2100ms". It is empty
+// when nothing was scraped.
+func (t *Timing) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.order) == 0 {
+		return ""
+	}
+
+	parts := make([]string, 0, len(t.order)+1)
+	for _, name := range t.order {
+		parts = append(parts, fmt.Sprintf("%s=%dms", name, t.phases[name].Milliseconds()))
+	}
+	parts = append(parts, fmt.Sprintf("total=%dms", time.Since(t.start).Milliseconds()))
+	return strings.Join(parts, ";")
+}
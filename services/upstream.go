@@ -0,0 +1,148 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// UserAgent is sent by both the browser and the HTTP client so TikTok sees one consistent client
+var UserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/130.0.0.0 Safari/537.36"
+
+// AcceptLanguage is the Accept-Language sent by both the browser and the HTTP client
+var AcceptLanguage = "en-US,en;q=0.9"
+
+// httpClient is used for every plain HTTP request made to TikTok and its CDNs
+var httpClient = &http.Client{}
+
+// proxyClient fetches user-supplied CDN URLs for the video and thumbnail proxies. It only
+// connects to the public addresses it vetted itself, see pinnedDialContext, and only
+// follows redirects to allowed hosts.
+var proxyClient = &http.Client{Transport: pinnedTransport(), CheckRedirect: checkProxyRedirect}
+
+// staticClient fetches TikTok pages without the browser. The page URL comes from the
+// caller, so like proxyClient it only connects to public addresses it vetted itself and
+// only follows redirects that stay on TikTok.
+var staticClient = &http.Client{Transport: pinnedTransport(), CheckRedirect: checkStaticRedirect}
+
+// checkStaticRedirect keeps static fetches on TikTok's own pages and caps the hops
+func checkStaticRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) > MaxRedirectHops {
+		return fmt.Errorf("%w: more than %d redirects", ErrUnexpectedContent, MaxRedirectHops)
+	}
+	if !isTikTokPage(req.URL) {
+		return fmt.Errorf("%w: redirect to %s, which is not a TikTok page", ErrForbiddenTarget, req.URL.Redacted())
+	}
+	return nil
+}
+
+// checkProxyRedirect holds every redirect to the same host allowlist as the first URL,
+// so an allowed CDN cannot bounce the proxy to another host, and caps the hops
+func checkProxyRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) > MaxRedirectHops {
+		return fmt.Errorf("%w: more than %d redirects", ErrUnexpectedContent, MaxRedirectHops)
+	}
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return fmt.Errorf("%w: redirect to %s", ErrForbiddenTarget, req.URL.Redacted())
+	}
+	if !isAllowedProxyHost(req.URL.Hostname()) {
+		return fmt.Errorf("%w: redirect to %s, which is not an allowed video host", ErrForbiddenTarget, req.URL.Hostname())
+	}
+	return nil
+}
+
+// pinnedTransport is the default transport dialing through pinnedDialContext
+func pinnedTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = pinnedDialContext
+	return transport
+}
+
+// setBrowserHeaders makes req look like it came from the scraping browser
+func setBrowserHeaders(req *http.Request) {
+	req.Header.Set("User-Agent", UserAgent)
+	req.Header.Set("Accept-Language", AcceptLanguage)
+}
+
+// CDNHeaders are the Referer and Origin the proxy sends to a CDN host
+type CDNHeaders struct {
+	Referer string `json:"referer"`
+	Origin  string `json:"origin,omitempty"`
+}
+
+// DefaultCDNHeaders are sent to every CDN host without an entry in CDNHeaderOverrides
+var DefaultCDNHeaders = CDNHeaders{Referer: "https://www.tiktok.com/"}
+
+// CDNHeaderOverrides maps a host suffix to the headers its CDN expects, for hosts that
+// refuse the default Referer. The longest matching suffix wins.
+var CDNHeaderOverrides = map[string]CDNHeaders{}
+
+// ParseCDNHeaders decodes a JSON object of host suffix to {"referer": ..., "origin": ...}
+func ParseCDNHeaders(raw string) (map[string]CDNHeaders, error) {
+	var overrides map[string]CDNHeaders
+	if err := json.Unmarshal([]byte(raw), &overrides); err != nil {
+		return nil, fmt.Errorf("invalid CDN headers: %w", err)
+	}
+
+	normalized := make(map[string]CDNHeaders, len(overrides))
+	for suffix, headers := range overrides {
+		suffix = strings.ToLower(strings.Trim(strings.TrimSpace(suffix), "."))
+		if suffix == "" {
+			return nil, fmt.Errorf("invalid CDN headers: empty host suffix")
+		}
+		normalized[suffix] = headers
+	}
+	return normalized, nil
+}
+
+// setCDNHeaders sets the Referer and Origin expected by the host of req
+func setCDNHeaders(req *http.Request) {
+	host := strings.ToLower(strings.TrimSuffix(req.URL.Hostname(), "."))
+
+	headers, matched := DefaultCDNHeaders, ""
+	for suffix, override := range CDNHeaderOverrides {
+		if (host == suffix || strings.HasSuffix(host, "."+suffix)) && len(suffix) > len(matched) {
+			headers, matched = override, suffix
+		}
+	}
+
+	if headers.Referer != "" {
+		req.Header.Set("Referer", headers.Referer)
+	}
+	if headers.Origin != "" {
+		req.Header.Set("Origin", headers.Origin)
+	}
+}
+
+// ParseProxyURL validates an upstream proxy URL, accepting http, https and socks5 schemes
+func ParseProxyURL(raw string) (*url.URL, error) {
+	proxyURL, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL %q: %w", raw, err)
+	}
+
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("invalid proxy URL %q: scheme must be http, https or socks5", raw)
+	}
+	if proxyURL.Hostname() == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q: missing host", raw)
+	}
+	return proxyURL, nil
+}
+
+// UseUpstreamProxy routes the HTTP clients through the given proxy, keeping the default
+// timeouts, keep-alives and HTTP/2. The proxy resolves the CDN hosts itself and may sit
+// at a private address, so proxied requests skip pinnedDialContext and rely on the host
+// checks of validateProxyTarget, fetchStatic and their redirect checks instead.
+func UseUpstreamProxy(proxyURL *url.URL) {
+	for _, client := range []*http.Client{httpClient, proxyClient, staticClient} {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.Proxy = http.ProxyURL(proxyURL)
+		client.Transport = transport
+	}
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// VideoCheck describes what the CDN answered for a video URL, without its body
+type VideoCheck struct {
+	OK            bool   `json:"ok"`
+	Status        int    `json:"status"`
+	ContentLength int64  `json:"contentLength"` // -1 when the CDN did not say
+	ContentType   string `json:"contentType"`
+
+	// LastModified is the CDN's Last-Modified, or a stable date derived from the URL when
+	// it sent none, which LastModifiedSynthesized then tells
+	LastModified            time.Time `json:"lastModified"`
+	LastModifiedSynthesized bool      `json:"lastModifiedSynthesized"`
+}
+
+// CheckVideoURL asks the CDN whether videoUrl is still live and how large it is, with a
+// HEAD request, or a one-byte range request for CDNs that reject HEAD. The URL goes
+// through the same allowlist and address checks as the proxy.
+func CheckVideoURL(ctx context.Context, videoUrl string) (*VideoCheck, error) {
+	if err := validateProxyTarget(ctx, videoUrl); err != nil {
+		return nil, err
+	}
+
+	resp, err := probeVideo(ctx, videoUrl, http.MethodHead)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented {
+		resp, err = probeVideo(ctx, videoUrl, http.MethodGet)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	check := &VideoCheck{
+		Status:        resp.StatusCode,
+		ContentLength: resp.ContentLength,
+		ContentType:   resp.Header.Get("Content-Type"),
+		LastModified:  videoLastModified(videoUrl, resp).UTC(),
+	}
+	_, err = http.ParseTime(resp.Header.Get("Last-Modified"))
+	check.LastModifiedSynthesized = err != nil
+
+	// A range response only carries one byte, the full size follows the slash
+	if contentRange := resp.Header.Get("Content-Range"); resp.StatusCode == http.StatusPartialContent && contentRange != "" {
+		if slash := strings.LastIndex(contentRange, "/"); slash >= 0 {
+			if size, err := strconv.ParseInt(contentRange[slash+1:], 10, 64); err == nil {
+				check.ContentLength = size
+			}
+		}
+	}
+
+	check.OK = checkUpstreamStatus(resp) == nil && (isVideoContentType(check.ContentType) || isHLSPlaylist(resp))
+	return check, nil
+}
+
+// probeVideo sends a bodiless request for videoUrl, a HEAD or a GET of the first byte
+func probeVideo(ctx context.Context, videoUrl, method string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, videoUrl, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+	setBrowserHeaders(req)
+	setCDNHeaders(req)
+	if method == http.MethodGet {
+		req.Header.Set("Range", "bytes=0-0")
+	}
+
+	resp, err := proxyClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp, nil
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// lastModifiedCDN serves a video with the given Last-Modified, none when it is empty
+func lastModifiedCDN(t *testing.T, lastModified string) string {
+	stubResolver(t, map[string][]string{"v16-webapp.tiktokcdn.com": {"93.184.216.34"}})
+	return fakeCDN(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "video/mp4")
+		if lastModified != "" {
+			w.Header().Set("Last-Modified", lastModified)
+		}
+		w.Write([]byte("mp4 bytes"))
+	})
+}
+
+func TestProxyPropagatesLastModified(t *testing.T) {
+	videoUrl := lastModifiedCDN(t, "Mon, 02 Jan 2023 15:04:05 GMT")
+
+	recorder := httptest.NewRecorder()
+	if err := streamVideo(recorder, httptest.NewRequest("GET", "/proxy-video", nil), videoUrl); err != nil {
+		t.Fatal(err)
+	}
+	if got := recorder.Header().Get("Last-Modified"); got != "Mon, 02 Jan 2023 15:04:05 GMT" {
+		t.Fatalf("Last-Modified %q, want the upstream date", got)
+	}
+
+	// A client holding that version gets a 304
+	req := httptest.NewRequest("GET", "/proxy-video", nil)
+	req.Header.Set("If-Modified-Since", "Mon, 02 Jan 2023 15:04:05 GMT")
+	recorder = httptest.NewRecorder()
+	if err := streamVideo(recorder, req, videoUrl); err != nil {
+		t.Fatal(err)
+	}
+	if recorder.Code != http.StatusNotModified {
+		t.Fatalf("status %d, want 304", recorder.Code)
+	}
+}
+
+func TestProxySynthesizesLastModified(t *testing.T) {
+	videoUrl := lastModifiedCDN(t, "")
+
+	get := func() string {
+		recorder := httptest.NewRecorder()
+		if err := streamVideo(recorder, httptest.NewRequest("GET", "/proxy-video", nil), videoUrl); err != nil {
+			t.Fatal(err)
+		}
+		return recorder.Header().Get("Last-Modified")
+	}
+
+	first := get()
+	lastModified, err := http.ParseTime(first)
+	if err != nil {
+		t.Fatalf("Last-Modified %q: %v", first, err)
+	}
+	if !lastModified.Equal(synthesizedLastModified(videoUrl).Truncate(time.Second)) || !lastModified.Before(time.Now()) {
+		t.Fatalf("Last-Modified %v, want the past date derived from the URL", lastModified)
+	}
+	if second := get(); second != first {
+		t.Fatalf("Last-Modified changed from %q to %q", first, second)
+	}
+}
+
+func TestCheckVideoURLLastModified(t *testing.T) {
+	tests := []struct {
+		name        string
+		upstream    string
+		synthesized bool
+	}{
+		{"present", "Mon, 02 Jan 2023 15:04:05 GMT", false},
+		{"absent", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			videoUrl := lastModifiedCDN(t, tt.upstream)
+			check, err := CheckVideoURL(context.Background(), videoUrl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if check.LastModifiedSynthesized != tt.synthesized {
+				t.Fatalf("LastModifiedSynthesized %v, want %v", check.LastModifiedSynthesized, tt.synthesized)
+			}
+
+			data, err := json.Marshal(check)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var body struct {
+				LastModified string `json:"lastModified"`
+			}
+			json.Unmarshal(data, &body)
+			if _, err := time.Parse(time.RFC3339, body.LastModified); err != nil {
+				t.Fatalf("lastModified %q is not RFC3339: %v", body.LastModified, err)
+			}
+			if tt.upstream != "" && body.LastModified != "2023-01-02T15:04:05Z" {
+				t.Fatalf("lastModified %s, want the upstream date", body.LastModified)
+			}
+		})
+	}
+}
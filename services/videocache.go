@@ -0,0 +1,272 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// videoCache is the on-disk cache used by the proxy, nil when disabled
+var videoCache *VideoCache
+
+// UseVideoCache enables the on-disk cache for proxied videos
+func UseVideoCache(cache *VideoCache) {
+	videoCache = cache
+}
+
+// videoCacheEntry tracks the size and last use of a cached file
+type videoCacheEntry struct {
+	size       int64
+	lastAccess time.Time
+	meta       videoCacheMeta
+}
+
+// videoCacheMeta holds the upstream headers replayed with a cached file, stored next to
+// it so segments and other non-mp4 responses keep their type across restarts
+type videoCacheMeta struct {
+	ContentType string `json:"contentType"`
+	ETag        string `json:"etag"`
+}
+
+// metaSuffix names the file holding a cached video's videoCacheMeta
+const metaSuffix = ".meta"
+
+// VideoCache is a content-addressed on-disk cache of proxied videos, keyed by a hash
+// of the video URL and evicting the least recently used files past maxBytes
+type VideoCache struct {
+	dir      string
+	maxBytes int64
+
+	mu      sync.Mutex
+	entries map[string]*videoCacheEntry
+	size    int64
+}
+
+// NewVideoCache opens (or creates) a cache in dir, indexing any files already there
+func NewVideoCache(dir string, maxBytes int64) (*VideoCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	cache := &VideoCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		entries:  make(map[string]*videoCacheEntry),
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		// Leftover temp files come from downloads interrupted by a restart
+		if strings.HasPrefix(file.Name(), ".tmp-") {
+			os.Remove(filepath.Join(dir, file.Name()))
+			continue
+		}
+
+		if strings.HasSuffix(file.Name(), metaSuffix) {
+			continue
+		}
+
+		info, err := file.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+
+		// Files cached before their headers were recorded may be HLS segments, which
+		// would go out as mp4, so they are dropped and fetched again
+		meta, ok := cache.readMeta(file.Name())
+		if !ok {
+			os.Remove(filepath.Join(dir, file.Name()))
+			continue
+		}
+		cache.entries[file.Name()] = &videoCacheEntry{size: info.Size(), lastAccess: info.ModTime(), meta: meta}
+		cache.size += info.Size()
+	}
+
+	cache.mu.Lock()
+	cache.evict()
+	cache.mu.Unlock()
+	return cache, nil
+}
+
+// key returns the file name used for videoUrl
+func (c *VideoCache) key(videoUrl string) string {
+	sum := sha256.Sum256([]byte(videoUrl))
+	return hex.EncodeToString(sum[:])
+}
+
+// readMeta loads the headers stored for key, false when there are none
+func (c *VideoCache) readMeta(key string) (videoCacheMeta, bool) {
+	var meta videoCacheMeta
+	data, err := os.ReadFile(filepath.Join(c.dir, key+metaSuffix))
+	if err != nil || json.Unmarshal(data, &meta) != nil || meta.ContentType == "" {
+		return meta, false
+	}
+	return meta, true
+}
+
+// serve writes the cached copy of videoUrl to w, honoring Range and conditional
+// headers, and reports whether the video was in the cache
+func (c *VideoCache) serve(w http.ResponseWriter, r *http.Request, videoUrl string) bool {
+	key := c.key(videoUrl)
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	var meta videoCacheMeta
+	if ok {
+		entry.lastAccess = time.Now()
+		meta = entry.meta
+	}
+	c.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	file, err := os.Open(filepath.Join(c.dir, key))
+	if err != nil {
+		// The file vanished behind our back, forget it and fall back to upstream
+		c.remove(key)
+		return false
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+
+	w.Header().Set("ETag", meta.ETag)
+	w.Header().Set("Content-Type", meta.ContentType)
+	http.ServeContent(w, r, "", info.ModTime(), file)
+	return true
+}
+
+// remove drops key from the index and deletes its file
+func (c *VideoCache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, ok := c.entries[key]; ok {
+		c.size -= entry.size
+		delete(c.entries, key)
+	}
+	os.Remove(filepath.Join(c.dir, key))
+	os.Remove(filepath.Join(c.dir, key+metaSuffix))
+}
+
+// evict deletes the least recently used files until the cache fits in maxBytes.
+// The caller must hold c.mu.
+func (c *VideoCache) evict() {
+	for c.size > c.maxBytes && len(c.entries) > 0 {
+		var oldestKey string
+		var oldest *videoCacheEntry
+		for key, entry := range c.entries {
+			if oldest == nil || entry.lastAccess.Before(oldest.lastAccess) {
+				oldestKey, oldest = key, entry
+			}
+		}
+
+		if err := os.Remove(filepath.Join(c.dir, oldestKey)); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to evict cached video %s: %v", oldestKey, err)
+		}
+		os.Remove(filepath.Join(c.dir, oldestKey+metaSuffix))
+		c.size -= oldest.size
+		delete(c.entries, oldestKey)
+	}
+}
+
+// newWriter starts caching videoUrl into a temp file that only becomes visible on commit.
+// meta holds the headers sent with the upstream response, replayed on every cache hit.
+func (c *VideoCache) newWriter(videoUrl string, lastModified time.Time, meta videoCacheMeta) (*videoCacheWriter, error) {
+	file, err := os.CreateTemp(c.dir, ".tmp-")
+	if err != nil {
+		return nil, err
+	}
+	return &videoCacheWriter{cache: c, key: c.key(videoUrl), file: file, lastModified: lastModified, meta: meta}, nil
+}
+
+// videoCacheWriter receives a copy of a streamed video. Write errors are remembered
+// rather than returned so a full disk never interrupts the client's stream.
+type videoCacheWriter struct {
+	cache        *VideoCache
+	key          string
+	file         *os.File
+	lastModified time.Time
+	meta         videoCacheMeta
+	size         int64
+	failed       bool
+}
+
+func (cw *videoCacheWriter) Write(p []byte) (int, error) {
+	if !cw.failed {
+		n, err := cw.file.Write(p)
+		cw.size += int64(n)
+		if err != nil {
+			cw.failed = true
+		}
+	}
+	return len(p), nil
+}
+
+// commit moves the finished file into the cache and evicts old entries if needed
+func (cw *videoCacheWriter) commit() {
+	tmpName := cw.file.Name()
+	if err := cw.file.Close(); err != nil || cw.failed || cw.size > cw.cache.maxBytes {
+		os.Remove(tmpName)
+		return
+	}
+
+	// The headers go in first so a visible file never lacks them
+	data, _ := json.Marshal(cw.meta)
+	if err := os.WriteFile(filepath.Join(cw.cache.dir, cw.key+metaSuffix), data, 0o644); err != nil {
+		os.Remove(tmpName)
+		return
+	}
+
+	os.Chtimes(tmpName, time.Now(), cw.lastModified)
+	if err := os.Rename(tmpName, filepath.Join(cw.cache.dir, cw.key)); err != nil {
+		os.Remove(tmpName)
+		return
+	}
+
+	cw.cache.mu.Lock()
+	defer cw.cache.mu.Unlock()
+
+	// A concurrent download of the same video may have been committed first
+	if existing, ok := cw.cache.entries[cw.key]; ok {
+		cw.cache.size -= existing.size
+	}
+	cw.cache.entries[cw.key] = &videoCacheEntry{size: cw.size, lastAccess: time.Now(), meta: cw.meta}
+	cw.cache.size += cw.size
+	cw.cache.evict()
+}
+
+// abort discards a partially written file
+func (cw *videoCacheWriter) abort() {
+	cw.file.Close()
+	os.Remove(cw.file.Name())
+}
+
+// isCompleteResponse reports whether resp carries the whole video, either as a plain
+// 200 or as a 206 whose Content-Range spans every byte
+func isCompleteResponse(resp *http.Response) bool {
+	if resp.StatusCode == http.StatusOK {
+		return true
+	}
+
+	var start, end, total int64
+	if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &total); err != nil {
+		return false
+	}
+	return start == 0 && end == total-1
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// useVideoCache enables a video cache in a temp dir for the test
+func useVideoCache(t *testing.T) *VideoCache {
+	t.Helper()
+
+	cache, err := NewVideoCache(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := videoCache
+	videoCache = cache
+	t.Cleanup(func() { videoCache = original })
+	return cache
+}
+
+// cachedCDN serves body with contentType, counting the requests that reach it
+func cachedCDN(t *testing.T, contentType, body string) (string, *atomic.Int32) {
+	t.Helper()
+
+	var hits atomic.Int32
+	videoUrl := fakeCDN(t, func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2023 15:04:05 GMT")
+		w.Write([]byte(body))
+	})
+	return videoUrl, &hits
+}
+
+// proxyGet streams videoUrl into a fresh recorder
+func proxyGet(t *testing.T, videoUrl string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	if err := streamVideo(recorder, httptest.NewRequest("GET", "/proxy-video", nil), videoUrl); err != nil {
+		t.Fatal(err)
+	}
+	return recorder
+}
+
+func TestVideoCacheReplaysHeaders(t *testing.T) {
+	cache := useVideoCache(t)
+	videoUrl, hits := cachedCDN(t, "video/webm", "webm bytes")
+
+	first := proxyGet(t, videoUrl)
+	second := proxyGet(t, videoUrl)
+	if hits.Load() != 1 {
+		t.Fatalf("CDN hit %d times, want the second request served from the cache", hits.Load())
+	}
+	if second.Body.String() != "webm bytes" {
+		t.Fatalf("cached body %q", second.Body.String())
+	}
+	for _, header := range []string{"Content-Type", "ETag", "Last-Modified"} {
+		if got, want := second.Header().Get(header), first.Header().Get(header); got != want {
+			t.Errorf("cached %s %q, upstream sent %q", header, got, want)
+		}
+	}
+
+	// The headers survive a restart
+	reopened, err := NewVideoCache(cache.dir, cache.maxBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	videoCache = reopened
+	third := proxyGet(t, videoUrl)
+	if hits.Load() != 1 {
+		t.Fatalf("CDN hit %d times after reopening the cache", hits.Load())
+	}
+	if got := third.Header().Get("Content-Type"); got != "video/webm" {
+		t.Errorf("Content-Type after restart %q, want video/webm", got)
+	}
+	if got, want := third.Header().Get("ETag"), first.Header().Get("ETag"); got != want {
+		t.Errorf("ETag after restart %q, want %q", got, want)
+	}
+}
+
+func TestVideoCacheEvictsHeaders(t *testing.T) {
+	cache := useVideoCache(t)
+	videoUrl, _ := cachedCDN(t, "video/mp4", "mp4 bytes")
+	proxyGet(t, videoUrl)
+
+	key := cache.key(videoUrl)
+	cache.remove(key)
+	if _, err := os.Stat(filepath.Join(cache.dir, key+metaSuffix)); !os.IsNotExist(err) {
+		t.Fatalf("headers file left behind: %v", err)
+	}
+}
+
+func TestVideoCacheKeepsSegmentType(t *testing.T) {
+	useVideoCache(t)
+	segmentUrl, hits := cachedCDN(t, "video/mp2t", "ts bytes")
+
+	proxyGet(t, segmentUrl)
+	cached := proxyGet(t, segmentUrl)
+	if hits.Load() != 1 {
+		t.Fatalf("CDN hit %d times, want the segment served from the cache", hits.Load())
+	}
+	if got := cached.Header().Get("Content-Type"); got != "video/mp2t" {
+		t.Fatalf("cached segment Content-Type %q, want video/mp2t", got)
+	}
+}
+
+func TestVideoCacheDropsFilesWithoutHeaders(t *testing.T) {
+	dir := t.TempDir()
+	legacy := filepath.Join(dir, strings.Repeat("ab", 32))
+	if err := os.WriteFile(legacy, []byte("ts bytes"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cache, err := NewVideoCache(dir, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cache.entries) != 0 || cache.size != 0 {
+		t.Fatalf("indexed %d files of %d bytes, want the file without headers dropped", len(cache.entries), cache.size)
+	}
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Fatalf("file without headers left on disk: %v", err)
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import "runtime"
+
+// Build information, injected at build time with
+// -ldflags "-X main.gitCommit=<sha> -X main.buildTime=<timestamp>"
+var (
+	gitCommit = "dev"
+	buildTime = "dev"
+)
+
+// versionInfo describes the running build
+type versionInfo struct {
+	GitCommit string `json:"gitCommit"`
+	BuildTime string `json:"buildTime"`
+	GoVersion string `json:"goVersion"`
+}
+
+// currentVersion returns the build information of this binary
+func currentVersion() versionInfo {
+	return versionInfo{
+		GitCommit: gitCommit,
+		BuildTime: buildTime,
+		GoVersion: runtime.Version(),
+	}
+}